@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// isOwner reports whether the user is the bot owner set in OWNER_ID.
+func isOwner(r Responder) bool {
+	return settings.OwnerID != "" && r.UserID() == settings.OwnerID
+}
+
+// isBotAdmin reports whether the user is the bot owner or one of
+// ADMIN_USER_IDS, who may change settings of the whole bot rather than of a
+// single server.
+func isBotAdmin(r Responder) bool {
+	return isOwner(r) || slices.Contains(settings.AdminUserIDs, r.UserID())
+}
+
+// guildName returns the name of a guild, or its ID if it can't be found.
+func guildName(s *discordgo.Session, guildID string) string {
+	if guild, err := s.State.Guild(guildID); err == nil {
+		return guild.Name
+	}
+	if guild, err := s.Guild(guildID); err == nil {
+		return guild.Name
+	}
+	return guildID
+}
+
+// handleActive lists the streams of every guild for the bot owner. It only
+// works in DMs, so the guild names aren't shown to other servers.
+func handleActive(s *discordgo.Session, r Responder, args []string) {
+	if !isOwner(r) || r.GuildID() != "" {
+		r.ReplyError("This command is only available to the bot owner in direct messages.")
+		return
+	}
+
+	conns := guilds.Connections()
+	if len(conns) == 0 {
+		r.Reply("No active streams.")
+		return
+	}
+
+	lines := make([]string, 0, len(conns)+1)
+	for _, conn := range conns {
+		lines = append(lines, fmt.Sprintf("- **%s**: %s at %d%% for %s (stream `%s`)",
+			guildName(s, conn.vc.GuildID),
+			conn.currentRadioName(),
+			int(math.Round(conn.currentVolume()*100)),
+			formatUptime(conn.uptime()),
+			conn.id,
+		))
+	}
+	slices.Sort(lines)
+	lines = append([]string{fmt.Sprintf("**%d active streams:**", len(conns))}, lines...)
+
+	replyChunked(r, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+type apiStatus struct {
+	Streaming bool   `json:"streaming"`
+	Station   string `json:"station,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Volume    int    `json:"volume"`
+	Paused    bool   `json:"paused"`
+	Uptime    string `json:"uptime,omitempty"`
+}
+
+type apiPlayRequest struct {
+	Radio         string `json:"radio"`
+	URL           string `json:"url"`
+	ChannelID     string `json:"channel_id"`
+	TextChannelID string `json:"text_channel_id"`
+}
+
+type apiVolumeRequest struct {
+	Volume *int `json:"volume"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// newAPIHandler returns the HTTP handler of the remote control API. The
+// metrics endpoint is served without the bearer token so it can be scraped.
+func newAPIHandler(s *discordgo.Session) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /guilds/{id}/status", withGuild(s, handleAPIStatus))
+	mux.HandleFunc("POST /guilds/{id}/play", withGuild(s, handleAPIPlay))
+	mux.HandleFunc("POST /guilds/{id}/stop", withGuild(s, handleAPIStop))
+	mux.HandleFunc("POST /guilds/{id}/volume", withGuild(s, handleAPIVolume))
+
+	root := http.NewServeMux()
+	root.Handle("GET /metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	root.Handle("/", requireToken(settings.HTTPToken, mux))
+
+	return root
+}
+
+// startHTTPServer serves the remote control API on settings.HTTPAddr.
+func startHTTPServer(s *discordgo.Session) {
+	log.Println("HTTP API listening on", settings.HTTPAddr)
+
+	err := http.ListenAndServe(settings.HTTPAddr, newAPIHandler(s))
+	if err != nil {
+		log.Println("Error running HTTP server:", err)
+	}
+}
+
+// requireToken rejects requests that don't carry the bearer token.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, apiError{Error: "invalid or missing token"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type guildHandlerFunc func(s *discordgo.Session, w http.ResponseWriter, r *http.Request, guildID string)
+
+// withGuild resolves the guild in the request path, answering 404 when the
+// bot isn't a member of it.
+func withGuild(s *discordgo.Session, next guildHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guildID := r.PathValue("id")
+		if _, err := s.State.Guild(guildID); err != nil {
+			writeJSON(w, http.StatusNotFound, apiError{Error: "unknown guild"})
+			return
+		}
+
+		next(s, w, r, guildID)
+	}
+}
+
+func handleAPIStatus(s *discordgo.Session, w http.ResponseWriter, r *http.Request, guildID string) {
+	conn, ok := activeConnection(guildID)
+	if !ok {
+		writeJSON(w, http.StatusOK, apiStatus{})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiStatus{
+		Streaming: true,
+		Station:   conn.currentRadioName(),
+		Title:     conn.currentTitle(),
+		Volume:    int(math.Round(conn.currentVolume() * 100)),
+		Paused:    conn.isPaused(),
+		Uptime:    formatUptime(conn.uptime()),
+	})
+}
+
+func handleAPIPlay(s *discordgo.Session, w http.ResponseWriter, r *http.Request, guildID string) {
+	var req apiPlayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid request body"})
+		return
+	}
+
+	if req.ChannelID == "" {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "channel_id is required"})
+		return
+	}
+
+	station := RadioStation{Name: strings.ToLower(req.Radio), URL: req.URL}
+	switch {
+	case station.URL != "":
+		if !isValidURL(station.URL) {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid stream URL"})
+			return
+		}
+		if err := checkStreamURL(station.URL); err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		if station.Name == "" {
+			station.Name = station.URL
+		}
+	case station.Name != "":
+		streamURL, ok := lookupRadio(station.Name)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "unknown radio station"})
+			return
+		}
+		station.URL = streamURL
+	default:
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "radio or url is required"})
+		return
+	}
+
+	if !isVoiceChannel(s, guildID, req.ChannelID) {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "channel_id is not a voice channel of this guild"})
+		return
+	}
+
+	_, err := startStream(s, guildID, req.ChannelID, req.TextChannelID, station)
+	var permErr *voicePermissionError
+	if errors.As(err, &permErr) {
+		writeJSON(w, http.StatusForbidden, apiError{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		log.Println("Error joining voice channel:", err)
+		writeJSON(w, http.StatusBadGateway, apiError{Error: "error joining voice channel"})
+		return
+	}
+
+	handleAPIStatus(s, w, r, guildID)
+}
+
+func handleAPIStop(s *discordgo.Session, w http.ResponseWriter, r *http.Request, guildID string) {
+	conn, ok := activeConnection(guildID)
+	if !ok || !stopConnection(s, conn) {
+		writeJSON(w, http.StatusConflict, apiError{Error: "nothing is playing"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleAPIVolume(s *discordgo.Session, w http.ResponseWriter, r *http.Request, guildID string) {
+	var req apiVolumeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid request body"})
+		return
+	}
+
+	if req.Volume == nil || *req.Volume < 0 || *req.Volume > settings.MaxVolume {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: fmt.Sprintf("volume must be a number between 0 and %d", settings.MaxVolume)})
+		return
+	}
+
+	conn, ok := activeConnection(guildID)
+	if !ok {
+		writeJSON(w, http.StatusConflict, apiError{Error: "nothing is playing"})
+		return
+	}
+
+	conn.setVolume(float64(*req.Volume) / 100.0)
+
+	handleAPIStatus(s, w, r, guildID)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Println("Error writing HTTP response:", err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// parseCommand splits a text message into a lowercased command name and its
+// arguments. ok is false when the message doesn't start with prefix or has no
+// command after it.
+func parseCommand(content, prefix string) (name string, args []string, ok bool) {
+	if !strings.HasPrefix(content, prefix) {
+		return "", nil, false
+	}
+
+	args = splitArgs(strings.TrimPrefix(content, prefix))
+	if len(args) == 0 {
+		return "", nil, false
+	}
+
+	return strings.ToLower(args[0]), args[1:], true
+}
+
+// splitArgs splits a command line into arguments at whitespace. Text between
+// double quotes, straight or curly as phone keyboards type them, is kept as a
+// single argument, so radio names may contain spaces. An unterminated quote
+// runs to the end of the line, and empty quotes are dropped.
+func splitArgs(line string) []string {
+	var args []string
+	var current strings.Builder
+	quoted := false
+
+	for _, r := range line {
+		switch {
+		case r == '"' || r == '“' || r == '”':
+			quoted = !quoted
+			continue
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				args = append(args, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		current.WriteRune(r)
+	}
+	if current.Len() > 0 {
+		args = append(args, current.String())
+	}
+
+	return args
+}
+
+// normalizeRadioName lowercases a radio name and collapses its whitespace,
+// so names match however they were typed.
+func normalizeRadioName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// radioNameArg joins the arguments of a command that takes only a radio
+// name, so the name may be given with or without quotes.
+func radioNameArg(args []string) string {
+	return normalizeRadioName(strings.Join(args, " "))
+}
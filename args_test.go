@@ -0,0 +1,70 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"play jazz", []string{"play", "jazz"}},
+		{"  play \t jazz  ", []string{"play", "jazz"}},
+		{`addradio http://radio.example.com/ "Radio Gaúcha FM"`, []string{"addradio", "http://radio.example.com/", "Radio Gaúcha FM"}},
+		{`playradio “Radio Gaúcha FM”`, []string{"playradio", "Radio Gaúcha FM"}},
+		{`playradio "Radio  Gaúcha"  fm`, []string{"playradio", "Radio  Gaúcha", "fm"}},
+		{`playradio "Radio Gaúcha`, []string{"playradio", "Radio Gaúcha"}},
+		{`playradio "" jazz`, []string{"playradio", "jazz"}},
+		{`playradio Radio"Gaúcha FM"`, []string{"playradio", "RadioGaúcha FM"}},
+		{`a "b c" "d e"`, []string{"a", "b c", "d e"}},
+	}
+	for _, tt := range tests {
+		if got := splitArgs(tt.line); !slices.Equal(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		content  string
+		wantName string
+		wantArgs []string
+		wantOK   bool
+	}{
+		{"!PlayRadio jazz", "playradio", []string{"jazz"}, true},
+		{`!playradio "Radio Gaúcha FM"`, "playradio", []string{"Radio Gaúcha FM"}, true},
+		{"!stop", "stop", []string{}, true},
+		{"!", "", nil, false},
+		{"! ", "", nil, false},
+		{"playradio jazz", "", nil, false},
+		{"?playradio jazz", "", nil, false},
+	}
+	for _, tt := range tests {
+		name, args, ok := parseCommand(tt.content, "!")
+		if name != tt.wantName || !slices.Equal(args, tt.wantArgs) || ok != tt.wantOK {
+			t.Errorf("parseCommand(%q) = %q, %q, %v, want %q, %q, %v", tt.content, name, args, ok, tt.wantName, tt.wantArgs, tt.wantOK)
+		}
+	}
+}
+
+func TestRadioNameArg(t *testing.T) {
+	// However the name was typed, quoted or not, it matches what addradio
+	// stored.
+	stored := normalizeRadioName("Radio Gaúcha FM")
+	for _, line := range []string{
+		`"Radio Gaúcha FM"`,
+		`“radio gaúcha fm”`,
+		`Radio Gaúcha FM`,
+		`  RADIO   Gaúcha  FM `,
+		`"Radio  Gaúcha" FM`,
+	} {
+		if got := radioNameArg(splitArgs(line)); got != stored {
+			t.Errorf("radioNameArg of %q = %q, want %q", line, got, stored)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"radio-bot/server/config"
+	"time"
+)
+
+// defaultChannelBitrate is the bitrate of a voice channel that doesn't say,
+// Discord's default for new channels.
+const defaultChannelBitrate = 64000
+
+// frameDuration is how much audio one Opus frame holds, and the cadence at
+// which Discord expects packets.
+const frameDuration = time.Duration(frameSize) * time.Second / time.Duration(frameRate)
+
+// silenceFrame is an Opus frame of silence. Sending it while there is no
+// audio keeps Discord from dropping the voice session.
+var silenceFrame = []byte{0xF8, 0xFF, 0xFE}
+
+// maxSample is the largest magnitude a sample may take after the gain is
+// applied. Clipping at the same magnitude on both sides keeps the waveform
+// symmetric, instead of letting negative samples reach -32768.
+const maxSample = math.MaxInt16
+
+// applyGain scales the samples in pcm by volume in place, rounding to the
+// nearest integer and clipping anything beyond ±maxSample. Unity gain only
+// raises -32768 to -maxSample and leaves the other samples untouched.
+func applyGain(pcm []int16, volume float64) {
+	if volume == 1 {
+		for i := range pcm {
+			pcm[i] = max(pcm[i], -maxSample)
+		}
+		return
+	}
+
+	for i := range pcm {
+		sample := math.Round(float64(pcm[i]) * volume)
+		if sample > maxSample {
+			sample = maxSample
+		} else if sample < -maxSample {
+			sample = -maxSample
+		}
+		pcm[i] = int16(sample)
+	}
+}
+
+// encoderBitrate returns the Opus bitrate for a voice channel of
+// channelBitrate, since Discord caps the bitrate of every channel and
+// anything above it only wastes bandwidth. It never exceeds maxBitrate, and
+// an unknown channel bitrate of 0 uses defaultChannelBitrate.
+func encoderBitrate(channelBitrate, maxBitrate int) int {
+	if channelBitrate <= 0 {
+		channelBitrate = defaultChannelBitrate
+	}
+	return max(config.MinAudioBitrate, min(channelBitrate, maxBitrate))
+}
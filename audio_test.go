@@ -0,0 +1,34 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestApplyGain(t *testing.T) {
+	tests := []struct {
+		name   string
+		pcm    []int16
+		volume float64
+		want   []int16
+	}{
+		{"silence", []int16{0, 0, 0}, 2, []int16{0, 0, 0}},
+		{"unity", []int16{math.MinInt16, -1, 0, 1, math.MaxInt16}, 1, []int16{-maxSample, -1, 0, 1, math.MaxInt16}},
+		{"mute", []int16{math.MinInt16, 1000, math.MaxInt16}, 0, []int16{0, 0, 0}},
+		{"half", []int16{1000, -1000, 3, -3}, 0.5, []int16{500, -500, 2, -2}},
+		{"full scale attenuated", []int16{math.MaxInt16, math.MinInt16}, 0.5, []int16{16384, -16384}},
+		{"full scale boosted", []int16{math.MaxInt16, math.MinInt16}, 1.5, []int16{maxSample, -maxSample}},
+		{"overdrive clips symmetrically", []int16{20000, -20000, 10000, -10000}, 2, []int16{maxSample, -maxSample, 20000, -20000}},
+		{"most negative sample", []int16{math.MinInt16}, 1.01, []int16{-maxSample}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pcm := slices.Clone(tt.pcm)
+			applyGain(pcm, tt.volume)
+			if !slices.Equal(pcm, tt.want) {
+				t.Errorf("applyGain(%v, %g) = %v, want %v", tt.pcm, tt.volume, pcm, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,1002 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"radio-bot/server/config"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+type commandHandler func(s *discordgo.Session, r Responder, args []string)
+
+var commandHandlers = map[string]commandHandler{
+	"help":           handleHelp,
+	"version":        handleVersion,
+	"playradio":      handlePlayRadio,
+	"play":           handlePlay,
+	"playfile":       handlePlayFile,
+	"enqueue":        handleEnqueue,
+	"queue":          handleQueue,
+	"shuffle":        handleShuffle,
+	"clear":          handleClear,
+	"skip":           handleSkip,
+	"voteskip":       handleVoteSkip,
+	"stop":           handleStop,
+	"replay":         handleReplay,
+	"last":           handleReplay,
+	"sleep":          handleSleep,
+	"listradios":     handleListRadios,
+	"volume":         handleVolume,
+	"mute":           handleMute,
+	"unmute":         handleUnmute,
+	"pause":          handlePause,
+	"resume":         handleResume,
+	"normalize":      handleNormalize,
+	"loop":           handleLoop,
+	"crossfade":      handleCrossfade,
+	"searchradio":    handleSearchRadio,
+	"searchnext":     handleSearchNext,
+	"searchprev":     handleSearchPrev,
+	"playstation":    handlePlayStation,
+	"addradio":       handleAddRadio,
+	"removeradio":    handleRemoveRadio,
+	"renameradio":    handleRenameRadio,
+	"importradios":   handleImportRadios,
+	"exportradios":   handleExportRadios,
+	"reloadstations": handleReloadStations,
+	"reload":         handleReload,
+	"loglevel":       handleLogLevel,
+	"active":         handleActive,
+	"testradio":      handleTestRadio,
+	"stats":          handleStats,
+	"suggest":        handleSuggest,
+	"join":           handleJoin,
+	"move":           handleMove,
+	"leave":          handleLeave,
+	"seek":           handleSeek,
+	"refresh":        handleRefresh,
+	"setcountry":     handleSetCountry,
+	"nowplaying":     handleNowPlaying,
+	"status":         handleStatus,
+	"setprefix":      handleSetPrefix,
+	"setdjrole":      handleSetDJRole,
+	"set":            handleSet,
+	"get":            handleGet,
+	"settings":       handleSettings,
+	"favorite":       handleFavorite,
+	"unfavorite":     handleUnfavorite,
+	"favorites":      handleFavorites,
+	"playfav":        handlePlayFav,
+}
+
+// dmCommands are the commands that work in direct messages, where there is
+// no guild.
+var dmCommands = map[string]bool{
+	"help":         true,
+	"exportradios": true,
+	"version":      true,
+	"active":       true,
+	"listradios":   true,
+	"searchradio":  true,
+	"searchnext":   true,
+	"searchprev":   true,
+	"suggest":      true,
+	"favorite":     true,
+	"unfavorite":   true,
+	"favorites":    true,
+	"stats":        true,
+}
+
+// handleCommand runs the handler registered for name, replying with an
+// error when the command is unknown or the user is rate limited.
+func handleCommand(s *discordgo.Session, r Responder, name string, args []string) {
+	if !allowCommand(r.UserID()) {
+		commandInvocations.WithLabelValues("ratelimited").Inc()
+		r.ReplyError("You are sending commands too fast. Please slow down.")
+		return
+	}
+
+	handler, ok := commandHandlers[name]
+	if !ok {
+		commandInvocations.WithLabelValues("unknown").Inc()
+		r.ReplyError(fmt.Sprintf("Unknown command. Use `%shelp` to see the list of available commands.", commandPrefix(r.GuildID())))
+		return
+	}
+
+	// Direct messages have no guild, so there is no voice channel to play
+	// in and no guild settings to change.
+	if r.GuildID() == "" && !dmCommands[name] {
+		r.ReplyError(fmt.Sprintf("This command only works in a server, use me in one of its channels. Here you can use `%[1]shelp`, `%[1]slistradios`, `%[1]ssearchradio` and your favorites.", commandPrefix("")))
+		return
+	}
+
+	if !canRunCommand(s, r, name) {
+		r.ReplyError("You need the DJ role or the Manage Server permission to use this command.")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"guild":   r.GuildID(),
+		"user":    r.UserID(),
+		"command": name,
+	}).Debug("Handling command")
+
+	commandInvocations.WithLabelValues(name).Inc()
+	handler(s, r, args)
+}
+
+// activeConnection returns the streaming connection for a guild, if any.
+func activeConnection(guildID string) (*Connection, bool) {
+	conn, ok := guilds.Connection(guildID)
+	if !ok || !conn.streaming {
+		return nil, false
+	}
+	return conn, true
+}
+
+func handleHelp(s *discordgo.Session, r Responder, args []string) {
+	helpMessage := "**Available Commands:**\n" +
+		"- `%[1]splayradio <radio_name> [#channel]`: Play a predefined or custom radio station, optionally in another voice channel.\n" +
+		"- `%[1]splay <url|radio_name>`: Play a stream URL or a YouTube link (needs yt-dlp).\n" +
+		"- `%[1]splayfile <path>`: Play a file from the audio directory, or an attached audio file (admins only).\n" +
+		"- `%[1]senqueue <radio_name>`: Add a radio station to the queue.\n" +
+		"- `%[1]squeue`: List the queued radio stations.\n" +
+		"- `%[1]sshuffle`: Put the queued radio stations in a random order.\n" +
+		"- `%[1]sclear`: Empty the queue, the current station keeps playing.\n" +
+		"- `%[1]sskip`: Skip to the next queued radio station.\n" +
+		"- `%[1]svoteskip`: Vote to skip the current station.\n" +
+		"- `%[1]snowplaying`: Show the track currently playing on the station.\n" +
+		"- `%[1]sstatus`: Show the playback status for this server.\n" +
+		"- `%[1]sstats [radio]`: Show the most listened stations, or the numbers of one station.\n" +
+		"- `%[1]sstop`: Stop playing and disconnect the bot from the voice channel.\n" +
+		"- `%[1]sjoin`: Join your voice channel without playing anything yet.\n" +
+		"- `%[1]smove`: Move the stream to your voice channel without restarting it.\n" +
+		"- `%[1]sleave`: Stop playing and leave the voice channel.\n" +
+		"- `%[1]sseek <m:ss|+seconds|-seconds>`: Jump within a file or video.\n" +
+		"- `%[1]srefresh`: Restart the current stream in place to clear a stale buffer.\n" +
+		"- `%[1]sreplay` / `%[1]slast`: Play the last station again after it stopped.\n" +
+		"- `%[1]ssleep <minutes|cancel>`: Stop playing after the given number of minutes.\n" +
+		"- `%[1]slistradios`: List all available radio stations.\n" +
+		"- `%[1]svolume [0-%[2]d|+N|-N]`: Set the volume level, change it by a step or show it.\n" +
+		"- `%[1]smute` / `%[1]sunmute`: Silence the stream without pausing it, and restore the volume.\n" +
+		"- `%[1]spause`: Pause the current stream.\n" +
+		"- `%[1]sresume`: Resume a paused stream.\n" +
+		"- `%[1]snormalize <on|off>`: Even out loudness between stations (uses more CPU).\n" +
+		"- `%[1]scrossfade <seconds>`: Fade between stations when switching, 0 turns it off (admins only).\n" +
+		"- `%[1]sloop <on|queue|off>`: Replay the current file or video when it ends, or repeat the whole queue.\n" +
+		"- `%[1]ssearchradio <keywords> [country:<name>] [countrycode:<code>] [tag:<tag>] [language:<name>]`: Search for radio stations by keywords and filters.\n" +
+		"- `%[1]ssearchnext` / `%[1]ssearchprev`: Browse the pages of search results.\n" +
+		"- `%[1]ssuggest [country]`: List popular stations, from a country or the one set for this server.\n" +
+		"- `%[1]splaystation <number>`: Play a radio station from the search results.\n" +
+		"- `%[1]saddradio <stream_url> <radio_name> [category]`: Add a custom radio station, optionally under a category. Quote names with spaces.\n" +
+		"- `%[1]sremoveradio <radio_name>`: Remove a custom radio station.\n" +
+		"- `%[1]srenameradio <old_name> <new_name>`: Rename a custom radio station.\n" +
+		"- `%[1]simportradios <url> [probe]`: Add the radio stations of a JSON or CSV list, or attach the file. `probe` checks each stream first (admins only).\n" +
+		"- `%[1]sexportradios`: Get the custom radio stations as a JSON file in a DM.\n" +
+		"- `%[1]sreloadstations`: Reload the built-in stations from the stations file (admins only).\n" +
+		"- `%[1]sreload`: Reload the log level, default prefix, stations and custom radios (bot owner and ADMIN_USER_IDS only).\n" +
+		"- `%[1]sloglevel <debug|info|warn|error>`: Change the log level until the next restart or reload (bot owner and ADMIN_USER_IDS only).\n" +
+		"- `%[1]sfavorite <radio_name>`: Add a radio station to your favorites.\n" +
+		"- `%[1]sunfavorite <radio_name>`: Remove a radio station from your favorites.\n" +
+		"- `%[1]sfavorites`: List your favorite radio stations.\n" +
+		"- `%[1]splayfav <number>` or `%[1]splayradio fav:<number>`: Play one of your favorites.\n" +
+		"- `%[1]ssetprefix <prefix>`: Change the command prefix for this server.\n" +
+		"- `%[1]ssetcountry <country|none>`: Set the country `%[1]ssuggest` lists stations from.\n" +
+		"- `%[1]ssetdjrole <role|none>`: Set the role allowed to stop, skip, change the volume and remove radios.\n" +
+		"- `%[1]ssettings` or `%[1]sget <key>`: Show the settings of this server.\n" +
+		"- `%[1]sset <key> <value|default>`: Change a setting of this server, or put it back to the default (admins only).\n" +
+		"- `%[1]sversion`: Show which build of the bot is running.\n" +
+		"- `%[1]shelp`: Display this help message."
+
+	replyChunked(r, fmt.Sprintf(helpMessage, commandPrefix(r.GuildID()), settings.MaxVolume))
+}
+
+func handlePlayRadio(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Please specify a radio to play. For example: `%splayradio gaucha`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	// A trailing channel mention picks the voice channel, and everything
+	// before it is the radio name.
+	voiceChannelID := ""
+	if len(args) > 1 {
+		if channelID, ok := parseChannelArg(args[len(args)-1]); ok {
+			if !isVoiceChannel(s, r.GuildID(), channelID) {
+				r.ReplyError(fmt.Sprintf("%s is not a voice channel of this server.", args[len(args)-1]))
+				return
+			}
+			voiceChannelID = channelID
+			args = args[:len(args)-1]
+		}
+	}
+
+	radioName := radioNameArg(args)
+
+	if n, ok := strings.CutPrefix(radioName, "fav:"); ok {
+		playFavorite(s, r, n)
+		return
+	}
+
+	radioName, streamURL, ok := resolveRadio(r, radioName)
+	if !ok {
+		return
+	}
+
+	voiceChannelID, err := voiceChannelFor(s, r, voiceChannelID)
+	if err != nil {
+		replyNotInVoiceChannel(r)
+		return
+	}
+
+	playRadioStream(s, r, RadioStation{Name: radioName, URL: streamURL}, voiceChannelID)
+}
+
+// resolveRadio finds the radio a user meant, tolerating typos and partial
+// names. When the name is unknown or ambiguous it replies with the
+// candidates and returns false.
+func resolveRadio(r Responder, radioName string) (string, string, bool) {
+	matches := matchRadios(radioName)
+	switch len(matches) {
+	case 0:
+		r.ReplyError(fmt.Sprintf("Unknown radio station: %s", radioName))
+		return "", "", false
+	case 1:
+		streamURL, ok := lookupRadio(matches[0])
+		if !ok {
+			r.ReplyError(fmt.Sprintf("Unknown radio station: %s", radioName))
+		}
+		return matches[0], streamURL, ok
+	}
+
+	r.ReplyError(fmt.Sprintf("Several radios match `%s`, which one did you mean? %s", radioName, "`"+strings.Join(matches, "`, `")+"`"))
+	return "", "", false
+}
+
+// parseChannelArg extracts the channel ID from a channel mention such as
+// <#123> or a bare channel ID.
+func parseChannelArg(arg string) (string, bool) {
+	id := strings.TrimSuffix(strings.TrimPrefix(arg, "<#"), ">")
+	if id == "" {
+		return "", false
+	}
+	for _, r := range id {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+
+	return id, true
+}
+
+// handlePlay plays a URL directly, or a radio station by name.
+func handlePlay(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Please specify a URL or radio to play. For example: `%splay https://www.youtube.com/watch?v=...`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	u, err := url.Parse(args[0])
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		handlePlayRadio(s, r, args)
+		return
+	}
+
+	voiceChannelID, err := voiceChannelFor(s, r, "")
+	if err != nil {
+		replyNotInVoiceChannel(r)
+		return
+	}
+
+	if err := checkStreamURL(args[0]); err != nil {
+		r.ReplyError(fmt.Sprintf("Can't play that URL: %v.", err))
+		return
+	}
+
+	playRadioStream(s, r, RadioStation{Name: args[0], URL: args[0]}, voiceChannelID)
+}
+
+func handleEnqueue(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Please specify a radio to enqueue. For example: `%senqueue gaucha`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	radioName, streamURL, ok := resolveRadio(r, radioNameArg(args))
+	if !ok {
+		return
+	}
+
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		voiceChannelID, err := voiceChannelFor(s, r, "")
+		if err != nil {
+			replyNotInVoiceChannel(r)
+			return
+		}
+		playRadioStream(s, r, RadioStation{Name: radioName, URL: streamURL}, voiceChannelID)
+		return
+	}
+
+	if !conn.queue.Push(RadioStation{Name: radioName, URL: streamURL}) {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	r.Reply(fmt.Sprintf("Added `%s` to the queue.", radioName))
+}
+
+func handleQueue(s *discordgo.Session, r Responder, args []string) {
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	stations := conn.queue.Items()
+	if len(stations) == 0 {
+		r.Reply("The queue is empty.")
+		return
+	}
+
+	replyChunked(r, "Up next:\n"+queueList(stations))
+}
+
+// queueList numbers the queued stations, one per line.
+func queueList(stations []RadioStation) string {
+	list := ""
+	for i, station := range stations {
+		list += fmt.Sprintf("%d. %s\n", i+1, station.Name)
+	}
+	return list
+}
+
+func handleShuffle(s *discordgo.Session, r Responder, args []string) {
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	switch conn.queue.Shuffle() {
+	case 0:
+		r.Reply("The queue is empty, there's nothing to shuffle.")
+		return
+	case 1:
+		r.Reply("There's only one station in the queue, there's nothing to shuffle.")
+		return
+	}
+
+	replyChunked(r, "Shuffled the queue. Up next:\n"+queueList(conn.queue.Items()))
+}
+
+func handleClear(s *discordgo.Session, r Responder, args []string) {
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	cleared := conn.queue.Clear()
+	removeQueuedTempAudio(cleared)
+	n := len(cleared)
+	if n == 0 {
+		r.Reply("The queue is already empty.")
+		return
+	}
+
+	r.Reply(fmt.Sprintf("Removed %d stations from the queue, %s keeps playing.", n, conn.currentRadioName()))
+}
+
+func handleSkip(s *discordgo.Session, r Responder, args []string) {
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	next, ok := conn.upNext()
+	if !ok {
+		replyNothingToSkipTo(r)
+		return
+	}
+
+	conn.resetSkipVotes()
+	conn.requestSkip()
+
+	r.Reply(fmt.Sprintf("Skipped to %s.", next.Name))
+}
+
+func handleStop(s *discordgo.Session, r Responder, args []string) {
+	conn, ok := activeConnection(r.GuildID())
+	if !ok || !stopConnection(s, conn) {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	r.Reply("Stopped playing.")
+}
+
+func handleReplay(s *discordgo.Session, r Responder, args []string) {
+	station, ok := lastStation(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing has been played yet, so there is nothing to replay.")
+		return
+	}
+
+	playRadioStream(s, r, station, "")
+}
+
+func handleSleep(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Usage: `%[1]ssleep <minutes>` or `%[1]ssleep cancel`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	if strings.ToLower(args[0]) == "cancel" || args[0] == "0" {
+		if !conn.setSleepTimer(s, 0) {
+			r.ReplyError("There is no sleep timer to cancel.")
+			return
+		}
+		r.Reply("Sleep timer cancelled.")
+		return
+	}
+
+	minutes, err := strconv.Atoi(args[0])
+	if err != nil || minutes < 0 {
+		r.ReplyError("Minutes must be a positive number.")
+		return
+	}
+
+	conn.setSleepTimer(s, time.Duration(minutes)*time.Minute)
+
+	r.Reply(fmt.Sprintf("Playback will stop in %d minute(s).", minutes))
+}
+
+// handleListRadios shows the radios in an embed, or as messages of text when
+// there are too many for one.
+func handleListRadios(s *discordgo.Session, r Responder, args []string) {
+	categories := radiosByCategory()
+	if !radioListFitsEmbed(categories) {
+		replyChunked(r, radioListText(categories))
+		return
+	}
+	r.ReplyEmbed(radioListEmbed(categories))
+}
+
+// handleVolume sets the volume to a percentage, changes it by a step with a
+// leading + or -, or reports it without an argument.
+func handleVolume(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		conn, ok := activeConnection(r.GuildID())
+		if !ok {
+			r.ReplyError("Nothing is playing.")
+			return
+		}
+
+		r.Reply("Volume: " + volumeLabel(conn.targetVolume(), conn.isMuted()))
+		return
+	}
+
+	volumeStr := args[0]
+	relative := strings.HasPrefix(volumeStr, "+") || strings.HasPrefix(volumeStr, "-")
+	volumeValue, err := strconv.Atoi(volumeStr)
+	if relative && err != nil {
+		r.ReplyError("Volume steps must be a number, like `+10` or `-10`.")
+		return
+	}
+	if !relative && (err != nil || volumeValue < 0 || volumeValue > settings.MaxVolume) {
+		r.ReplyError(fmt.Sprintf("Volume must be a number between 0 and %d.", settings.MaxVolume))
+		return
+	}
+
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	var volume float64
+	if relative {
+		volume = conn.adjustVolume(float64(volumeValue)/100.0, float64(settings.MaxVolume)/100.0)
+	} else {
+		volume = float64(volumeValue) / 100.0
+		conn.setVolume(volume)
+	}
+
+	if conn.isMuted() {
+		r.Reply(fmt.Sprintf("Volume set to %d%%, it applies when you unmute.", volumePercent(volume)))
+		return
+	}
+	r.Reply(fmt.Sprintf("Volume set to %d%%.", volumePercent(volume)))
+}
+
+// volumePercent converts a volume to the whole percentage shown to users.
+func volumePercent(volume float64) int {
+	return int(math.Round(volume * 100))
+}
+
+func handlePause(s *discordgo.Session, r Responder, args []string) {
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	if !conn.setPaused(true) {
+		r.ReplyError("The stream is already paused.")
+		return
+	}
+	conn.startPauseTimeout(s)
+
+	r.Reply(fmt.Sprintf("Paused. Use `%sresume` to continue.", commandPrefix(r.GuildID())))
+}
+
+func handleResume(s *discordgo.Session, r Responder, args []string) {
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	if !conn.setPaused(false) {
+		r.ReplyError("The stream isn't paused.")
+		return
+	}
+
+	r.Reply("Resumed.")
+}
+
+func handleNormalize(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Usage: `%snormalize <on|off>`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	mode := strings.ToLower(args[0])
+
+	var normalize bool
+	switch mode {
+	case "on":
+		normalize = true
+	case "off":
+		normalize = false
+	default:
+		r.ReplyError("Normalization must be `on` or `off`.")
+		return
+	}
+
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	if !conn.setNormalize(normalize) {
+		r.Reply(fmt.Sprintf("Normalization is already %s.", mode))
+		return
+	}
+
+	r.Reply(fmt.Sprintf("Normalization turned %s.", mode))
+}
+
+func handleSearchRadio(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError("Please provide keywords to search for radio stations.")
+		return
+	}
+
+	query, unknown := parseSearchQuery(args)
+	if len(unknown) > 0 {
+		r.ReplyError(fmt.Sprintf("Ignoring unknown search filters: %s. Supported filters are country, countrycode, tag and language.", strings.Join(unknown, ", ")))
+	}
+	if query.isEmpty() {
+		r.ReplyError("Please provide keywords to search for radio stations.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), searchTimeout)
+	defer cancel()
+
+	stations, err := cachedSearchRadioStations(ctx, query)
+	if err != nil {
+		replySearchError(r, err)
+		log.Println("Error searching for radio stations:", err)
+		return
+	}
+
+	if len(stations) == 0 {
+		r.Reply(fmt.Sprintf("No radio stations found for your query. Use `%ssuggest` to see popular stations.", commandPrefix(r.GuildID())))
+		return
+	}
+
+	sr := storeSearchResults(r.UserID(), stations)
+	r.ReplyEmbed(searchResultsEmbed(sr, commandPrefix(r.GuildID())))
+}
+
+func handleSearchNext(s *discordgo.Session, r Responder, args []string) {
+	showSearchPage(r, 1)
+}
+
+func handleSearchPrev(s *discordgo.Session, r Responder, args []string) {
+	showSearchPage(r, -1)
+}
+
+func showSearchPage(r Responder, pageDelta int) {
+	sr, ok := getSearchResults(r.UserID(), pageDelta)
+	if !ok {
+		replyNoSearchResults(r)
+		return
+	}
+
+	r.ReplyEmbed(searchResultsEmbed(sr, commandPrefix(r.GuildID())))
+}
+
+func handlePlayStation(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError("Please specify the number of the station to play.")
+		return
+	}
+
+	index, err := strconv.Atoi(args[0])
+	if err != nil {
+		r.ReplyError("Invalid station number.")
+		return
+	}
+
+	// Check before looking at the results so the user only has to join a
+	// channel and repeat the command; the results are kept either way.
+	voiceChannelID, err := voiceChannelFor(s, r, "")
+	if err != nil {
+		replyNotInVoiceChannel(r)
+		return
+	}
+
+	sr, ok := getSearchResults(r.UserID(), 0)
+	stations := sr.Stations
+	if !ok || len(stations) == 0 {
+		replyNoSearchResults(r)
+		return
+	}
+
+	if index < 1 || index > len(stations) {
+		r.ReplyError("Station number out of range.")
+		return
+	}
+
+	playRadioStream(s, r, stations[index-1], voiceChannelID)
+}
+
+func handleAddRadio(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 2 {
+		r.ReplyError(fmt.Sprintf("Usage: `%saddradio <stream_url> <radio_name> [category]`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	streamURL := args[0]
+	radioName := normalizeRadioName(args[1])
+	category := strings.Join(args[2:], " ")
+
+	if !isValidURL(streamURL) {
+		r.ReplyError("Invalid stream URL.")
+		return
+	}
+
+	if err := checkStreamURL(streamURL); err != nil {
+		r.ReplyError(fmt.Sprintf("Stream URL check failed: %v.", err))
+		return
+	}
+
+	if err := probeStream(streamURL); err != nil {
+		r.ReplyError(fmt.Sprintf("Stream URL check failed: %v.", err))
+		return
+	}
+
+	err := store.SaveCustomRadio(radioName, CustomRadio{URL: streamURL, Category: category})
+	if err != nil {
+		log.Println("Error saving custom radio:", err)
+		r.ReplyError("Error saving the custom radio.")
+		return
+	}
+
+	r.Reply(fmt.Sprintf("Custom radio `%s` added.", radioName))
+}
+
+func handleRenameRadio(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 2 {
+		r.ReplyError(fmt.Sprintf("Usage: `%srenameradio <old_name> <new_name>`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	oldName := normalizeRadioName(args[0])
+	newName := normalizeRadioName(args[1])
+
+	if _, ok := builtinRadio(oldName); ok {
+		r.ReplyError(fmt.Sprintf("`%s` is a built-in radio station and can't be renamed.", oldName))
+		return
+	}
+	if _, ok := builtinRadio(newName); ok {
+		r.ReplyError(fmt.Sprintf("`%s` is already the name of a built-in radio station.", newName))
+		return
+	}
+
+	ok, err := store.RenameCustomRadio(oldName, newName)
+	if errors.Is(err, errRadioExists) {
+		r.ReplyError(fmt.Sprintf("A custom radio named `%s` already exists.", newName))
+		return
+	}
+	if err != nil {
+		log.Println("Error renaming custom radio:", err)
+		r.ReplyError("Error renaming the custom radio.")
+		return
+	}
+	if !ok {
+		r.ReplyError(fmt.Sprintf("No such custom radio: %s", oldName))
+		return
+	}
+
+	r.Reply(fmt.Sprintf("Custom radio `%s` renamed to `%s`.", oldName, newName))
+}
+
+func handleRemoveRadio(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Usage: `%sremoveradio <radio_name>`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	radioName := radioNameArg(args)
+
+	if _, ok := builtinRadio(radioName); ok {
+		r.ReplyError(fmt.Sprintf("`%s` is a built-in radio station and can't be removed.", radioName))
+		return
+	}
+
+	ok, err := store.DeleteCustomRadio(radioName)
+	if err != nil {
+		log.Println("Error removing custom radio:", err)
+		r.ReplyError("Error removing the custom radio.")
+		return
+	}
+	if !ok {
+		r.ReplyError(fmt.Sprintf("No such custom radio: %s", radioName))
+		return
+	}
+
+	r.Reply(fmt.Sprintf("Custom radio `%s` removed.", radioName))
+}
+
+func handleNowPlaying(s *discordgo.Session, r Responder, args []string) {
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	title := conn.currentTitle()
+	if title == "" {
+		r.Reply(fmt.Sprintf("Now playing radio: %s (no track information available)", conn.currentRadioName()))
+		return
+	}
+
+	r.Reply(fmt.Sprintf("Now playing on %s: %s", conn.currentRadioName(), title))
+}
+
+// handleSetPrefix is !set prefix, kept under its own name.
+func handleSetPrefix(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Usage: `%ssetprefix <prefix>`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	if !changeGuildSetting(s, r, "prefix", args[0]) {
+		return
+	}
+
+	r.Reply(fmt.Sprintf("Command prefix set to `%s`.", commandPrefix(r.GuildID())))
+}
+
+func handleLogLevel(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Usage: `%sloglevel <debug|info|warn|error>`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	if !isBotAdmin(r) {
+		r.ReplyError("Only the bot owner and admins can change the log level, since it applies to every server.")
+		return
+	}
+
+	var level config.LogLevelDecoder
+	err := level.Decode(args[0])
+	if err != nil {
+		r.ReplyError("The log level must be `debug`, `info`, `warn` or `error`.")
+		return
+	}
+
+	log.SetLevel(log.Level(level))
+	// Logged at warn level so it shows up whatever the new level is.
+	log.WithFields(log.Fields{"user": r.UserID(), "guild": r.GuildID()}).Warnf("Log level changed to %s", log.Level(level))
+
+	r.Reply(fmt.Sprintf("Log level set to `%s`.", log.Level(level)))
+}
+
+func handleStatus(s *discordgo.Session, r Responder, args []string) {
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.Reply("Nothing is playing.")
+		return
+	}
+
+	state := "Streaming"
+	if conn.isPaused() {
+		state = "Paused"
+	}
+
+	status := fmt.Sprintf("**Status:** %s\n", state) +
+		fmt.Sprintf("**Station:** %s\n", conn.currentRadioName()) +
+		fmt.Sprintf("**Volume:** %s\n", volumeLabel(conn.targetVolume(), conn.isMuted())) +
+		fmt.Sprintf("**Loop:** %s\n", conn.loopMode()) +
+		fmt.Sprintf("**Playing for:** %s\n", formatUptime(conn.uptime()))
+	if !conn.isLive() {
+		status += fmt.Sprintf("**Position:** %s\n", formatPosition(conn.position()))
+	}
+	status += fmt.Sprintf("**Stream ID:** `%s`", conn.id)
+
+	r.Reply(status)
+}
+
+// formatUptime formats d as hours and minutes, e.g. "1h23m".
+func formatUptime(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours := d / time.Hour
+	minutes := (d % time.Hour) / time.Minute
+
+	if hours > 0 {
+		return fmt.Sprintf("%dh%02dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+func handleFavorite(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Usage: `%sfavorite <radio_name>`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	radioName := radioNameArg(args)
+
+	if _, ok := lookupRadio(radioName); !ok {
+		r.ReplyError(fmt.Sprintf("Unknown radio station: %s", radioName))
+		return
+	}
+
+	added, err := addFavorite(r.UserID(), radioName)
+	if err != nil {
+		log.Println("Error saving favorite:", err)
+		r.ReplyError("Error saving your favorite.")
+		return
+	}
+	if !added {
+		r.ReplyError(fmt.Sprintf("`%s` is already in your favorites.", radioName))
+		return
+	}
+
+	r.Reply(fmt.Sprintf("Added `%s` to your favorites.", radioName))
+}
+
+func handleUnfavorite(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Usage: `%sunfavorite <radio_name>`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	radioName := radioNameArg(args)
+
+	removed, err := removeFavorite(r.UserID(), radioName)
+	if err != nil {
+		log.Println("Error removing favorite:", err)
+		r.ReplyError("Error removing your favorite.")
+		return
+	}
+	if !removed {
+		r.ReplyError(fmt.Sprintf("`%s` is not in your favorites.", radioName))
+		return
+	}
+
+	r.Reply(fmt.Sprintf("Removed `%s` from your favorites.", radioName))
+}
+
+func handleFavorites(s *discordgo.Session, r Responder, args []string) {
+	names := userFavorites(r.UserID())
+	if len(names) == 0 {
+		r.Reply(fmt.Sprintf("You have no favorites yet. Use `%sfavorite <radio_name>` to add one.", commandPrefix(r.GuildID())))
+		return
+	}
+
+	response := "Your favorite stations:\n"
+	for i, name := range names {
+		if _, ok := lookupRadio(name); !ok {
+			response += fmt.Sprintf("%d. %s (no longer available)\n", i+1, name)
+			continue
+		}
+		response += fmt.Sprintf("%d. %s\n", i+1, name)
+	}
+	response += fmt.Sprintf("\nUse `%splayfav <number>` to play a favorite.", commandPrefix(r.GuildID()))
+
+	replyChunked(r, response)
+}
+
+func handlePlayFav(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError("Please specify the number of the favorite to play.")
+		return
+	}
+
+	playFavorite(s, r, args[0])
+}
+
+// playFavorite plays the n-th (1-based) favorite of the user.
+func playFavorite(s *discordgo.Session, r Responder, n string) {
+	index, err := strconv.Atoi(n)
+	if err != nil {
+		r.ReplyError("Invalid favorite number.")
+		return
+	}
+
+	names := userFavorites(r.UserID())
+	if index < 1 || index > len(names) {
+		r.ReplyError("Favorite number out of range.")
+		return
+	}
+
+	radioName := names[index-1]
+	streamURL, ok := lookupRadio(radioName)
+	if !ok {
+		r.ReplyError(fmt.Sprintf("`%s` is no longer available. Use `%sunfavorite %s` to remove it.", radioName, commandPrefix(r.GuildID()), radioName))
+		return
+	}
+
+	voiceChannelID, err := voiceChannelFor(s, r, "")
+	if err != nil {
+		replyNotInVoiceChannel(r)
+		return
+	}
+
+	playRadioStream(s, r, RadioStation{Name: radioName, URL: streamURL}, voiceChannelID)
+}
+
+// handleSetDJRole is !set djrole, which also takes none to clear the role.
+func handleSetDJRole(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Usage: `%ssetdjrole <role|none>`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	role := strings.Join(args, " ")
+	if strings.EqualFold(role, "none") {
+		role = resetValue
+	}
+	if !changeGuildSetting(s, r, "djrole", role) {
+		return
+	}
+
+	if role = djRole(r.GuildID()); role == "" {
+		r.Reply("DJ role cleared. Only members with the Manage Server permission can use the restricted commands.")
+		return
+	}
+	r.Reply(fmt.Sprintf("DJ role set to `%s`.", role))
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type recordedReply struct {
+	text    string
+	isError bool
+	embed   *discordgo.MessageEmbed
+}
+
+// recordingResponder records the replies to a command instead of sending
+// them.
+type recordingResponder struct {
+	guildID, userID, channelID string
+
+	replies []recordedReply
+}
+
+func (r *recordingResponder) GuildID() string   { return r.guildID }
+func (r *recordingResponder) UserID() string    { return r.userID }
+func (r *recordingResponder) ChannelID() string { return r.channelID }
+
+func (r *recordingResponder) Reply(text string) {
+	r.replies = append(r.replies, recordedReply{text: text})
+}
+
+func (r *recordingResponder) ReplyError(text string) {
+	r.replies = append(r.replies, recordedReply{text: text, isError: true})
+}
+
+func (r *recordingResponder) ReplyEmbed(embed *discordgo.MessageEmbed) string {
+	r.replies = append(r.replies, recordedReply{embed: embed})
+	return ""
+}
+
+// The users of the guild set up by setupCommandTest.
+const (
+	testOwner   = "100"
+	testManager = "200"
+	testDJ      = "300"
+	testMember  = "400"
+	testAdmin   = "500"
+
+	testTextChannel  = "10"
+	testVoiceChannel = "20"
+)
+
+// setupCommandTest returns a session whose state holds a guild "guild" with
+// a text channel, a voice channel and the test users, so the
+// permission checks don't call Discord. The settings, stations and guild
+// settings are reset for the test, which runs in a temporary directory.
+func setupCommandTest(t *testing.T) *discordgo.Session {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	js, err := newJSONStore(radiosFile, favoritesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previousSettings, previousStore, previousGuilds := settings, store, guilds
+	previousLimiter, previousGuildSettings := commandLimiter, guildSettings
+	streamURLsMutex.Lock()
+	previousStreamURLs := streamURLs
+	streamURLs = map[string]string{"gaucha": "http://gaucha.example.com/live"}
+	streamURLsMutex.Unlock()
+
+	settings.CommandPrefix = "!"
+	settings.MaxVolume = 200
+	settings.OwnerID = testOwner
+	settings.AdminUserIDs = []string{testAdmin}
+	store, guilds = js, NewGuildManager()
+	commandLimiter = newRateLimiter(0, 1)
+	guildSettingsMutex.Lock()
+	guildSettings = map[string]GuildSettings{"guild": {DJRole: "dj"}}
+	guildSettingsMutex.Unlock()
+
+	t.Cleanup(func() {
+		settings, store, guilds = previousSettings, previousStore, previousGuilds
+		commandLimiter = previousLimiter
+		guildSettingsMutex.Lock()
+		guildSettings = previousGuildSettings
+		guildSettingsMutex.Unlock()
+		streamURLsMutex.Lock()
+		streamURLs = previousStreamURLs
+		streamURLsMutex.Unlock()
+		os.Chdir(wd)
+	})
+
+	state := discordgo.NewState()
+	state.User = &discordgo.User{ID: "bot"}
+	member := func(id string, roles ...string) *discordgo.Member {
+		return &discordgo.Member{GuildID: "guild", User: &discordgo.User{ID: id}, Roles: roles}
+	}
+	err = state.GuildAdd(&discordgo.Guild{
+		ID:      "guild",
+		OwnerID: testOwner,
+		Roles: []*discordgo.Role{
+			{ID: "guild", Name: "@everyone", Permissions: discordgo.PermissionViewChannel | discordgo.PermissionSendMessages | discordgo.PermissionVoiceConnect},
+			{ID: "managers", Name: "Managers", Permissions: discordgo.PermissionManageServer},
+			{ID: "dj", Name: "DJ"},
+		},
+		Channels: []*discordgo.Channel{
+			{ID: testTextChannel, GuildID: "guild", Type: discordgo.ChannelTypeGuildText},
+			{ID: testVoiceChannel, GuildID: "guild", Type: discordgo.ChannelTypeGuildVoice},
+		},
+		Members: []*discordgo.Member{
+			member("bot"),
+			member(testOwner),
+			member(testManager, "managers"),
+			member(testDJ, "dj"),
+			member(testMember),
+			member(testAdmin),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &discordgo.Session{State: state}
+}
+
+// runCommand runs a command from user in the guild, or in a DM when guildID
+// is empty, and returns its replies.
+func runCommand(s *discordgo.Session, guildID, userID, name string, args ...string) []recordedReply {
+	r := &recordingResponder{guildID: guildID, userID: userID, channelID: testTextChannel}
+	handleCommand(s, r, name, args)
+	return r.replies
+}
+
+func TestHandleCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		guildID string
+		userID  string
+		command string
+		args    []string
+		// want is part of the first reply expected, which is an error
+		// unless wantOK is set.
+		want   string
+		wantOK bool
+	}{
+		{"unknown command", "guild", testMember, "dance", nil, "Unknown command. Use `!help`", false},
+		{"help", "guild", testMember, "help", nil, "**Available Commands:**", true},
+
+		// Guild-only and DM-only commands.
+		{"guild command in a DM", "", testMember, "stop", nil, "only works in a server", false},
+		{"volume in a DM", "", testOwner, "volume", []string{"50"}, "only works in a server", false},
+		{"help in a DM", "", testMember, "help", nil, "**Available Commands:**", true},
+		{"active in a guild", "guild", testOwner, "active", nil, "only available to the bot owner in direct messages", false},
+		{"active from another user", "", testMember, "active", nil, "only available to the bot owner in direct messages", false},
+		{"active from the owner", "", testOwner, "active", nil, "No active streams.", true},
+
+		// Usage errors.
+		{"playradio without a name", "guild", testMember, "playradio", nil, "Please specify a radio to play. For example: `!playradio gaucha`", false},
+		{"play without a URL", "guild", testMember, "play", nil, "Please specify a URL or radio to play.", false},
+		{"enqueue without a name", "guild", testMember, "enqueue", nil, "Please specify a radio to enqueue.", false},
+		{"sleep without minutes", "guild", testMember, "sleep", nil, "Usage: `!sleep <minutes>` or `!sleep cancel`", false},
+		{"seek without a position", "guild", testManager, "seek", nil, "Usage: `!seek", false},
+		{"setprefix without a prefix", "guild", testManager, "setprefix", nil, "Usage: `!setprefix <prefix>`", false},
+		{"loglevel without a level", "guild", testAdmin, "loglevel", nil, "Usage: `!loglevel", false},
+		{"set without a value", "guild", testManager, "set", []string{"prefix"}, "Usage: `!set <key>", false},
+
+		// Unknown stations.
+		{"unknown station", "guild", testMember, "playradio", []string{"nosuch"}, "Unknown radio station: nosuch", false},
+		{"unknown quoted station", "guild", testMember, "playradio", []string{"No Such  Radio"}, "Unknown radio station: no such radio", false},
+		{"enqueue unknown station", "guild", testMember, "enqueue", []string{"nosuch"}, "Unknown radio station: nosuch", false},
+		{"known station out of voice", "guild", testMember, "playradio", []string{"gaucha"}, "You must be in a voice channel", false},
+		{"station in a text channel", "guild", testMember, "playradio", []string{"gaucha", "<#10>"}, "<#10> is not a voice channel of this server.", false},
+
+		// Volume.
+		{"volume over the maximum", "guild", testManager, "volume", []string{"500"}, "Volume must be a number between 0 and 200.", false},
+		{"volume step without a number", "guild", testManager, "volume", []string{"-"}, "Volume steps must be a number", false},
+		{"volume not a number", "guild", testManager, "volume", []string{"loud"}, "Volume must be a number between 0 and 200.", false},
+		{"volume step not a number", "guild", testManager, "volume", []string{"+loud"}, "Volume steps must be a number", false},
+		{"volume with nothing playing", "guild", testManager, "volume", []string{"50"}, "Nothing is playing.", false},
+		{"volume from the DJ role", "guild", testDJ, "volume", []string{"500"}, "Volume must be a number between 0 and 200.", false},
+		{"volume from a member", "guild", testMember, "volume", []string{"50"}, "You need the DJ role or the Manage Server permission", false},
+		{"stop from a member", "guild", testMember, "stop", nil, "You need the DJ role or the Manage Server permission", false},
+		{"stop with nothing playing", "guild", testManager, "stop", nil, "Nothing is playing.", false},
+
+		// Settings of the server and of the bot.
+		{"setprefix from a member", "guild", testMember, "setprefix", []string{"?"}, "You need the Manage Server permission", false},
+		{"setprefix too long", "guild", testManager, "setprefix", []string{"!!!!!!"}, "Invalid value for `prefix`", false},
+		{"setprefix", "guild", testManager, "setprefix", []string{"?"}, "Command prefix set to `?`.", true},
+		{"setdjrole from the DJ role", "guild", testDJ, "setdjrole", []string{"none"}, "You need the Manage Server permission", false},
+		{"crossfade from a member", "guild", testMember, "crossfade", []string{"5"}, "You need the Manage Server permission", false},
+		{"crossfade out of range", "guild", testManager, "crossfade", []string{"60"}, "Invalid value for `crossfade`", false},
+		{"crossfade", "guild", testManager, "crossfade", []string{"5"}, "Stations will crossfade over 5 seconds.", true},
+		{"setcountry from a member", "guild", testMember, "setcountry", []string{"Brazil"}, "You need the Manage Server permission", false},
+		{"reload from a manager", "guild", testManager, "reload", nil, "Only the bot owner and admins can reload the settings", false},
+		{"loglevel from a manager", "guild", testManager, "loglevel", []string{"debug"}, "Only the bot owner and admins can change the log level", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := setupCommandTest(t)
+
+			replies := runCommand(s, tt.guildID, tt.userID, tt.command, tt.args...)
+			if len(replies) == 0 {
+				t.Fatal("the command wasn't answered")
+			}
+			got := replies[0]
+			if !strings.Contains(got.text, tt.want) || got.isError == tt.wantOK {
+				t.Errorf("reply = %q (error %v), want one containing %q (error %v)", got.text, got.isError, tt.want, !tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestHandleCommandPrefix(t *testing.T) {
+	s := setupCommandTest(t)
+
+	runCommand(s, "guild", testManager, "setprefix", "?")
+	replies := runCommand(s, "guild", testMember, "dance")
+	if len(replies) != 1 || !strings.Contains(replies[0].text, "Use `?help`") {
+		t.Errorf("unknown command after setprefix = %+v, want the new prefix", replies)
+	}
+
+	// The prefix only changed in the guild.
+	replies = runCommand(s, "", testMember, "dance")
+	if len(replies) != 1 || !strings.Contains(replies[0].text, "Use `!help`") {
+		t.Errorf("unknown command in a DM = %+v, want the default prefix", replies)
+	}
+}
+
+func TestHandleCommandRateLimit(t *testing.T) {
+	s := setupCommandTest(t)
+	commandLimiter = newRateLimiter(time.Hour, 2)
+
+	for range 2 {
+		replies := runCommand(s, "guild", testMember, "version")
+		if len(replies) != 1 || replies[0].isError {
+			t.Fatalf("command within the limit = %+v", replies)
+		}
+	}
+	replies := runCommand(s, "guild", testMember, "version")
+	if len(replies) != 1 || !strings.Contains(replies[0].text, "too fast") {
+		t.Errorf("command over the limit = %+v, want it refused", replies)
+	}
+
+	// Other users and admins aren't held up.
+	if replies := runCommand(s, "guild", testManager, "version"); len(replies) != 1 || replies[0].isError {
+		t.Errorf("command from another user = %+v", replies)
+	}
+	for range 3 {
+		if replies := runCommand(s, "guild", testAdmin, "version"); len(replies) != 1 || replies[0].isError {
+			t.Errorf("command from an admin = %+v", replies)
+		}
+	}
+}
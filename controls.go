@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// volumeStep is how much the volume reactions change the volume, in percent.
+const volumeStep = 10
+
+const (
+	emojiPause      = "⏸️"
+	emojiResume     = "▶️"
+	emojiSkip       = "⏭️"
+	emojiStop       = "⏹️"
+	emojiVolumeDown = "🔉"
+	emojiVolumeUp   = "🔊"
+)
+
+// playbackControls are the reactions added to the now-playing message, in
+// the order they are shown.
+var playbackControls = []string{emojiPause, emojiResume, emojiSkip, emojiStop, emojiVolumeDown, emojiVolumeUp}
+
+func (c *Connection) controlMessage() string {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	return c.controlMessageID
+}
+
+func (c *Connection) setControlMessage(messageID string) {
+	c.controlMu.Lock()
+	c.controlMessageID = messageID
+	c.controlMu.Unlock()
+}
+
+// addPlaybackControls turns messageID into the control message of player by
+// adding the playback reactions to it.
+func addPlaybackControls(s *discordgo.Session, player Player, channelID, messageID string) {
+	player.setControlMessage(messageID)
+
+	for _, emoji := range playbackControls {
+		err := s.MessageReactionAdd(channelID, messageID, emoji)
+		if err != nil {
+			log.Println("Error adding playback control:", err)
+			return
+		}
+	}
+}
+
+// reactionCommand maps a control reaction to the command it runs.
+func reactionCommand(emoji string) (string, []string, bool) {
+	switch emoji {
+	case emojiPause:
+		return "pause", nil, true
+	case emojiResume:
+		return "resume", nil, true
+	case emojiSkip:
+		return "skip", nil, true
+	case emojiStop:
+		return "stop", nil, true
+	case emojiVolumeDown:
+		return "volume", []string{"-" + strconv.Itoa(volumeStep)}, true
+	case emojiVolumeUp:
+		return "volume", []string{"+" + strconv.Itoa(volumeStep)}, true
+	}
+
+	return "", nil, false
+}
+
+// onMessageReactionAdd runs the playback controls clicked on the now-playing
+// message by users listening in the bot's voice channel.
+func onMessageReactionAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	if r.UserID == s.State.User.ID {
+		return
+	}
+
+	conn, ok := activeConnection(r.GuildID)
+	if !ok || conn.controlMessage() != r.MessageID {
+		return
+	}
+
+	name, args, ok := reactionCommand(r.Emoji.Name)
+	if !ok {
+		return
+	}
+
+	// Remove the reaction so the control can be clicked again.
+	err := s.MessageReactionRemove(r.ChannelID, r.MessageID, r.Emoji.APIName(), r.UserID)
+	if err != nil {
+		log.Println("Error removing playback control reaction:", err)
+	}
+
+	if getUserVoiceChannelID(s, r.GuildID, r.UserID) != conn.vc.ChannelID {
+		return
+	}
+
+	handleCommand(s, &reactionResponder{s: s, r: r}, name, args)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxCrossfade bounds how long two ffmpeg processes decode side by side.
+const maxCrossfade = 10 * time.Second
+
+// crossfadeDuration returns how long station switches fade in a guild, or
+// zero when they cut straight over.
+func crossfadeDuration(guildID string) time.Duration {
+	guildSettingsMutex.RLock()
+	defer guildSettingsMutex.RUnlock()
+
+	return time.Duration(guildSettings[guildID].Crossfade) * time.Second
+}
+
+// crossfade mixes from into to in place for frame step of a fade lasting
+// steps frames. The gains follow an equal-power curve computed per sample,
+// so the combined loudness stays level and the ramp has no steps at frame
+// boundaries. Both slices hold the same number of interleaved samples.
+func crossfade(from, to []int16, step, steps int) {
+	frames := len(to) / channels
+	for i := range to {
+		t := (float64(step) + float64(i/channels)/float64(frames)) / float64(steps)
+		sample := math.Round(float64(from[i])*math.Cos(t*math.Pi/2) + float64(to[i])*math.Sin(t*math.Pi/2))
+		if sample > maxSample {
+			sample = maxSample
+		} else if sample < -maxSample {
+			sample = -maxSample
+		}
+		to[i] = int16(sample)
+	}
+}
+
+// fadeInto keeps playing from until to has buffered audio, then pushes the
+// crossfade between them over the given duration. It returns errStreamStopped
+// when push gives up, or the error of to if the new stream fails to start.
+// The caller closes both sources.
+func fadeInto(from, to AudioSource, duration time.Duration, push func([]int16) bool) error {
+	ready := make(chan error, 1)
+	go func() {
+		ready <- to.prebuffer(prebufferFrames)
+	}()
+
+buffering:
+	for {
+		select {
+		case err := <-ready:
+			if err != nil {
+				return err
+			}
+			break buffering
+		default:
+		}
+
+		pcm := make([]int16, frameSize*channels)
+		if from.readFrame(pcm) != nil {
+			// The previous station ended on its own, so there is nothing
+			// left to fade from.
+			return <-ready
+		}
+		if !push(pcm) {
+			return errStreamStopped
+		}
+	}
+
+	steps := int(duration / frameDuration)
+	for step := 0; step < steps; step++ {
+		pcm := make([]int16, frameSize*channels)
+		err := to.readFrame(pcm)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+
+		previous := make([]int16, frameSize*channels)
+		if from.readFrame(previous) == nil {
+			crossfade(previous, pcm, step, steps)
+		}
+
+		if !push(pcm) {
+			return errStreamStopped
+		}
+		// The new station ended already, after its padded last frame.
+		if err != nil {
+			return io.EOF
+		}
+	}
+
+	return nil
+}
+
+func handleCrossfade(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Usage: `%scrossfade <seconds>`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	if !changeGuildSetting(s, r, "crossfade", args[0]) {
+		return
+	}
+
+	seconds := crossfadeDuration(r.GuildID())
+	if seconds == 0 {
+		r.Reply("Crossfade turned off.")
+		return
+	}
+	r.Reply(fmt.Sprintf("Stations will crossfade over %d seconds.", int(seconds.Seconds())))
+}
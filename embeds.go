@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord rejects embeds whose parts exceed these lengths.
+const (
+	embedDescriptionLimit = 4096
+	embedFieldNameLimit   = 256
+	embedFieldValueLimit  = 1024
+	embedFooterLimit      = 2048
+	embedFieldsLimit      = 25
+	embedTotalLimit       = 6000
+
+	embedColor     = 0x1db954
+	embedLoudColor = 0xe67e22
+
+	volumeBarLength = 10
+)
+
+// truncate shortens s to at most limit characters, marking the cut with an
+// ellipsis.
+func truncate(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// volumeBar draws the volume as a bar relative to settings.MaxVolume.
+func volumeBar(volume float64) string {
+	percent := math.Round(volume * 100)
+	filled := int(math.Round(percent / float64(settings.MaxVolume) * volumeBarLength))
+	filled = max(0, min(filled, volumeBarLength))
+
+	return fmt.Sprintf("%s%s %.0f%%", strings.Repeat("▰", filled), strings.Repeat("▱", volumeBarLength-filled), percent)
+}
+
+// volumeLabel draws the volume bar, marking it when the stream is muted.
+func volumeLabel(volume float64, muted bool) string {
+	if muted {
+		return "🔇 Muted, " + volumeBar(volume)
+	}
+	return volumeBar(volume)
+}
+
+// stationLinks lists the stream and homepage links of a station.
+func stationLinks(station RadioStation) string {
+	links := fmt.Sprintf("[Stream](%s)", station.URL)
+	if station.Homepage != "" {
+		links += fmt.Sprintf(" · [Homepage](%s)", station.Homepage)
+	}
+	return links
+}
+
+// nowPlayingEmbed announces the station that started playing.
+func nowPlayingEmbed(station RadioStation, volume float64, muted bool) *discordgo.MessageEmbed {
+	color := embedColor
+	if volume > 1 {
+		color = embedLoudColor
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Now playing",
+		Description: truncate(station.Name, embedDescriptionLimit),
+		Color:       color,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Links", Value: truncate(stationLinks(station), embedFieldValueLimit)},
+			{Name: "Volume", Value: volumeLabel(volume, muted)},
+		},
+	}
+	if station.Favicon != "" {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: station.Favicon}
+	}
+
+	return embed
+}
+
+// radioListEmbed lists the radio names of each category, with the built-in
+// stations first and the other categories in alphabetical order.
+func radioListEmbed(categories map[string][]string) *discordgo.MessageEmbed {
+	names := categoryOrder(categories)
+
+	embed := &discordgo.MessageEmbed{
+		Title: "Available radios",
+		Color: embedColor,
+	}
+	for _, category := range names {
+		if len(embed.Fields) == embedFieldsLimit {
+			embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%d more categories not shown", len(names)-embedFieldsLimit)}
+			break
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  truncate(category, embedFieldNameLimit),
+			Value: truncate(strings.Join(categories[category], ", "), embedFieldValueLimit),
+		})
+	}
+	if len(embed.Fields) == 0 {
+		embed.Description = "No radios available."
+	}
+
+	return embed
+}
+
+// radioListFitsEmbed reports whether radioListEmbed can show every radio,
+// without leaving out categories or cutting off names, within the total
+// size Discord allows for an embed.
+func radioListFitsEmbed(categories map[string][]string) bool {
+	if len(categories) > embedFieldsLimit {
+		return false
+	}
+
+	total := 0
+	for category, names := range categories {
+		value := utf8.RuneCountInString(strings.Join(names, ", "))
+		if utf8.RuneCountInString(category) > embedFieldNameLimit || value > embedFieldValueLimit {
+			return false
+		}
+		total += utf8.RuneCountInString(category) + value
+	}
+	return total <= embedTotalLimit
+}
+
+// radioListText lists the radios of each category as text, for lists too
+// long for an embed.
+func radioListText(categories map[string][]string) string {
+	lines := []string{"**Available radios:**"}
+	for _, category := range categoryOrder(categories) {
+		lines = append(lines, fmt.Sprintf("**%s:** %s", category, strings.Join(categories[category], ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// categoryOrder sorts the categories by name, except for the built-in
+// stations, which come first.
+func categoryOrder(categories map[string][]string) []string {
+	names := make([]string, 0, len(categories))
+	for category := range categories {
+		if category != defaultCategory {
+			names = append(names, category)
+		}
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	})
+	if _, ok := categories[defaultCategory]; ok {
+		names = append([]string{defaultCategory}, names...)
+	}
+	return names
+}
+
+// searchResultsEmbed renders the current page of results. Stations are
+// numbered by their absolute position so `!playstation` works across pages.
+func searchResultsEmbed(sr SearchResults, prefix string) *discordgo.MessageEmbed {
+	start := sr.Page * searchPageSize
+	end := min(start+searchPageSize, len(sr.Stations))
+
+	fields := make([]*discordgo.MessageEmbedField, 0, end-start)
+	for i := start; i < end; i++ {
+		station := sr.Stations[i]
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  truncate(fmt.Sprintf("%d. %s", i+1, station.Name), embedFieldNameLimit),
+			Value: truncate(fmt.Sprintf("%d votes · %s", station.Votes, stationLinks(station)), embedFieldValueLimit),
+		})
+	}
+
+	footer := fmt.Sprintf("Page %d of %d.", sr.Page+1, sr.pageCount())
+	if sr.pageCount() > 1 {
+		footer += fmt.Sprintf(" Use %[1]ssearchnext and %[1]ssearchprev to browse.", prefix)
+	}
+	footer += fmt.Sprintf(" Use %splaystation <number> to play a station.", prefix)
+
+	return &discordgo.MessageEmbed{
+		Title:  "Found the following stations",
+		Color:  embedColor,
+		Fields: fields,
+		Footer: &discordgo.MessageEmbedFooter{Text: truncate(footer, embedFooterLimit)},
+	}
+}
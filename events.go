@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"radio-bot/server/config"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	eventQueueSize = 100
+	brokerTimeout  = 5 * time.Second
+)
+
+var errEventQueueFull = errors.New("event queue is full")
+
+// EventPublisher sends playback events to a message broker, so other
+// processes can follow the streams of the bot.
+type EventPublisher interface {
+	Publish(e webhookEvent) error
+}
+
+// publisher is opened in main once the settings are loaded. It doesn't
+// publish anywhere unless a broker is configured.
+var publisher EventPublisher = noopPublisher{}
+
+type noopPublisher struct{}
+
+func (noopPublisher) Publish(e webhookEvent) error { return nil }
+
+// openPublisher opens the publisher for the broker selected in the settings.
+// Connecting happens on the first event, so the bot starts while the broker
+// is down.
+func openPublisher(broker config.EventBroker, brokerURL, subject string) (EventPublisher, error) {
+	var next EventPublisher
+	var err error
+	switch broker {
+	case config.EventBrokerNone:
+		return noopPublisher{}, nil
+	case config.EventBrokerNATS:
+		next, err = newNATSPublisher(brokerURL, subject)
+	case config.EventBrokerRedis:
+		next, err = newRedisPublisher(brokerURL, subject)
+	default:
+		return nil, fmt.Errorf("unknown event broker %q", broker)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	q := &queuedPublisher{next: next, events: make(chan webhookEvent, eventQueueSize)}
+	go q.run()
+	return q, nil
+}
+
+// queuedPublisher hands events to a single goroutine that publishes them in
+// order, so a slow or unreachable broker never holds up a stream. Events are
+// dropped when the queue is full.
+type queuedPublisher struct {
+	next   EventPublisher
+	events chan webhookEvent
+}
+
+func (q *queuedPublisher) Publish(e webhookEvent) error {
+	select {
+	case q.events <- e:
+		return nil
+	default:
+		return errEventQueueFull
+	}
+}
+
+func (q *queuedPublisher) run() {
+	for e := range q.events {
+		err := q.next.Publish(e)
+		if err != nil {
+			log.Printf("Error publishing %s event: %v", e.Event, err)
+		}
+	}
+}
+
+// brokerConn is a connection to a broker that is dialed when needed and
+// dropped after any error, so the next publish reconnects.
+type brokerConn struct {
+	addr string
+	conn net.Conn
+}
+
+// get returns the connection, dialing it and running handshake on it first
+// if there is none.
+func (b *brokerConn) get(handshake func(net.Conn) error) (net.Conn, error) {
+	if b.conn != nil {
+		return b.conn, nil
+	}
+
+	conn, err := net.DialTimeout("tcp", b.addr, brokerTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(brokerTimeout))
+	err = handshake(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	b.conn = conn
+	return conn, nil
+}
+
+func (b *brokerConn) reset() {
+	if b.conn != nil {
+		b.conn.Close()
+		b.conn = nil
+	}
+}
+
+// brokerAddr returns the host:port of a broker URL, using defaultPort when
+// it has none.
+func brokerAddr(host, defaultPort string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, defaultPort)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// addFavorite adds a radio to the user's favorites, reporting false if it
+// was already there.
+func addFavorite(userID, radioName string) (bool, error) {
+	return store.SaveFavorite(userID, radioName)
+}
+
+// removeFavorite removes a radio from the user's favorites, reporting false
+// if it wasn't there.
+func removeFavorite(userID, radioName string) (bool, error) {
+	return store.DeleteFavorite(userID, radioName)
+}
+
+// userFavorites returns the user's favorite radio names.
+func userFavorites(userID string) []string {
+	names, err := store.ListFavorites(userID)
+	if err != nil {
+		log.Println("Error listing favorites:", err)
+	}
+	return names
+}
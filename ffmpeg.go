@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	frameBytes = frameSize * channels * 2
+
+	// prebufferFrames is how much audio a restarted ffmpeg must have decoded
+	// before it replaces the running one.
+	prebufferFrames  = 10
+	prebufferTimeout = 10 * time.Second
+
+	// stderrLines and stderrBytes bound the ffmpeg output kept to explain a
+	// failure. Longer lines are cut, keeping the end.
+	stderrLines = 5
+	stderrBytes = 600
+)
+
+var errFFmpegMissing = errors.New("ffmpeg is not available")
+
+// lookPath finds executables. It is a variable so the lookup can be stubbed.
+var lookPath = exec.LookPath
+
+// checkFFmpeg reports whether the configured ffmpeg binary can be found.
+func checkFFmpeg() error {
+	_, err := lookPath(settings.FFmpegPath)
+	if err != nil {
+		return fmt.Errorf("%w at %q: %v", errFFmpegMissing, settings.FFmpegPath, err)
+	}
+	return nil
+}
+
+// ffmpegSource is a running ffmpeg process decoding a stream into PCM.
+type ffmpegSource struct {
+	url       string
+	cmd       *exec.Cmd
+	reader    *bufio.Reader
+	stderr    *stderrTail
+	closeOnce sync.Once
+	waitErr   error
+}
+
+// ffmpegError is ffmpeg exiting with an error before it decoded any audio,
+// along with the last lines it logged.
+type ffmpegError struct {
+	err    error
+	output string
+}
+
+func (e *ffmpegError) Error() string {
+	if e.output == "" {
+		return "ffmpeg failed: " + e.err.Error()
+	}
+	return fmt.Sprintf("ffmpeg failed: %v: %s", e.err, e.output)
+}
+
+func (e *ffmpegError) Unwrap() error { return e.err }
+
+// stderrTail logs each line ffmpeg writes to stderr at debug level and keeps
+// the last few to report when it fails.
+type stderrTail struct {
+	log     *log.Entry
+	lines   []string
+	partial []byte
+	mu      sync.Mutex
+}
+
+func (t *stderrTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.partial = append(t.partial, p...)
+	for {
+		// ffmpeg ends progress lines with a carriage return.
+		i := bytes.IndexAny(t.partial, "\r\n")
+		if i < 0 {
+			break
+		}
+		t.add(string(t.partial[:i]))
+		t.partial = t.partial[i+1:]
+	}
+	if len(t.partial) > stderrBytes {
+		t.add(string(t.partial))
+		t.partial = nil
+	}
+
+	return len(p), nil
+}
+
+func (t *stderrTail) add(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	t.log.Debug(line)
+	t.lines = append(t.lines, line)
+	if len(t.lines) > stderrLines {
+		t.lines = t.lines[1:]
+	}
+}
+
+// String returns the last lines ffmpeg logged, cut to stderrBytes.
+func (t *stderrTail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	lines := t.lines
+	if line := strings.TrimSpace(string(t.partial)); line != "" {
+		lines = append(lines[:len(lines):len(lines)], line)
+	}
+
+	out := strings.Join(lines, "\n")
+	if len(out) > stderrBytes {
+		out = "…" + out[len(out)-stderrBytes:]
+	}
+	return out
+}
+
+// startFFmpeg launches ffmpeg to decode streamURL into raw PCM frames from
+// the start position on.
+func startFFmpeg(streamURL string, normalize bool, start time.Duration) (*ffmpegSource, error) {
+	return runFFmpeg(streamURL, ffmpegArgs(streamURL, normalize, start))
+}
+
+// runFFmpeg launches ffmpeg with args and reads what it writes to stdout.
+func runFFmpeg(streamURL string, args []string) (*ffmpegSource, error) {
+	cmd := exec.Command(settings.FFmpegPath, args...)
+	stderr := &stderrTail{log: log.WithField("url", streamURL)}
+	cmd.Stderr = stderr
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error getting ffmpeg stdout: %w", err)
+	}
+
+	err = cmd.Start()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, errFFmpegMissing
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error starting ffmpeg: %w", err)
+	}
+
+	return &ffmpegSource{
+		url:    streamURL,
+		cmd:    cmd,
+		reader: bufio.NewReaderSize(out, 16*frameBytes),
+		stderr: stderr,
+	}, nil
+}
+
+// readFrame reads the next frame of interleaved samples into pcm, see
+// readPCMFrame.
+func (src *ffmpegSource) readFrame(pcm []int16) error {
+	return readPCMFrame(src.reader, pcm)
+}
+
+// readPCMFrame reads a frame of little-endian samples from r into pcm. When
+// the input ends cleanly between frames it returns io.EOF. When it ends
+// partway through one, the samples read are kept, the rest of pcm is zeroed
+// and io.ErrUnexpectedEOF is returned, so the last frame can still be played
+// before stopping.
+func readPCMFrame(r io.Reader, pcm []int16) error {
+	buf := make([]byte, len(pcm)*2)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+
+	// A trailing odd byte is half a sample, which can't be played.
+	samples := n / 2
+	for i := range pcm {
+		if i < samples {
+			pcm[i] = int16(binary.LittleEndian.Uint16(buf[i*2:]))
+		} else {
+			pcm[i] = 0
+		}
+	}
+	return err
+}
+
+func (src *ffmpegSource) sourceURL() string { return src.url }
+
+// Read reads ffmpeg's output as it is, like the Ogg of the passthrough.
+func (src *ffmpegSource) Read(p []byte) (int, error) {
+	return src.reader.Read(p)
+}
+
+// prebuffer blocks until ffmpeg has decoded the given number of frames.
+func (src *ffmpegSource) prebuffer(frames int) error {
+	_, err := src.reader.Peek(frames * frameBytes)
+	return err
+}
+
+// Close kills the ffmpeg process and waits for it to exit. It is safe to call
+// more than once.
+func (src *ffmpegSource) Close() {
+	src.closeOnce.Do(func() {
+		src.cmd.Process.Kill()
+		src.waitErr = src.cmd.Wait()
+	})
+}
+
+// exitError closes the source and returns an ffmpegError if ffmpeg had
+// exited with an error status on its own, rather than being killed.
+func (src *ffmpegSource) exitError() error {
+	src.Close()
+
+	var exitErr *exec.ExitError
+	if !errors.As(src.waitErr, &exitErr) || exitErr.ExitCode() <= 0 {
+		return nil
+	}
+	return &ffmpegError{err: src.waitErr, output: src.stderr.String()}
+}
+
+// httpInputArgs make ffmpeg reconnect to HTTP streams that drop, which
+// flaky Icecast servers do regularly.
+var httpInputArgs = []string{
+	"-reconnect", "1",
+	"-reconnect_streamed", "1",
+	"-reconnect_delay_max", "5",
+}
+
+// ffmpegInputArgs returns the ffmpeg options for reading streamURL. HTTP
+// inputs get the reconnect options, the stream proxy and the User-Agent
+// followed by settings.FFmpegInputArgs.
+func ffmpegInputArgs(streamURL string) []string {
+	var args []string
+	if isHTTPURL(streamURL) {
+		args = append(args, httpInputArgs...)
+		if streamProxyURL != "" {
+			args = append(args, "-http_proxy", streamProxyURL)
+		}
+		args = append(args, "-user_agent", userAgent())
+		args = append(args, settings.FFmpegInputArgs...)
+	}
+	return args
+}
+
+func isHTTPURL(streamURL string) bool {
+	return strings.HasPrefix(streamURL, "http://") || strings.HasPrefix(streamURL, "https://")
+}
+
+// ffmpegArgs builds the ffmpeg arguments to decode streamURL into raw PCM.
+// A start position seeks the input before decoding, which only finite
+// sources support.
+// Normalization runs the EBU R128 loudnorm filter, which evens out the
+// loudness between stations at the cost of noticeably more CPU per stream.
+func ffmpegArgs(streamURL string, normalize bool, start time.Duration) []string {
+	args := ffmpegInputArgs(streamURL)
+	if start > 0 {
+		args = append(args, "-ss", fmt.Sprintf("%.3f", start.Seconds()))
+	}
+	args = append(args, "-i", streamURL)
+	if normalize {
+		args = append(args, "-af", "loudnorm=I=-16:TP=-1.5:LRA=11")
+	}
+
+	return append(args,
+		"-f", "s16le",
+		"-ar", fmt.Sprint(frameRate),
+		"-ac", fmt.Sprint(channels),
+		"pipe:1",
+	)
+}
+
+// restartStream starts a new ffmpeg for streamURL at the start position and
+// hands it over to the running stream once it has buffered enough audio, so
+// the switch leaves only a minimal gap. playStream kills and waits for the
+// replaced process. It returns errNotDecoding right away when no stream is
+// being read to hand the new one over to.
+func restartStream(conn *Connection, streamURL string, start time.Duration) error {
+	if !conn.decoding.Load() {
+		return errNotDecoding
+	}
+
+	src, err := newAudioSource(streamURL, conn.normalizeEnabled(), start)
+	if err != nil {
+		return err
+	}
+
+	buffered := make(chan error, 1)
+	go func() {
+		buffered <- src.prebuffer(prebufferFrames)
+	}()
+
+	timeout := time.NewTimer(prebufferTimeout)
+	defer timeout.Stop()
+
+	select {
+	case err = <-buffered:
+	case <-conn.done:
+		err = errStreamStopped
+	case <-timeout.C:
+		err = errors.New("timed out buffering the restarted stream")
+	}
+	if err != nil {
+		src.Close()
+		return err
+	}
+
+	select {
+	case conn.swap <- src:
+		conn.logger().Println("Switched to restarted stream")
+		return nil
+	case <-conn.done:
+		err = errStreamStopped
+	case <-timeout.C:
+		err = errors.New("timed out handing over the restarted stream")
+	}
+
+	src.Close()
+	return err
+}
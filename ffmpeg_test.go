@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os/exec"
+	"slices"
+	"testing"
+	"testing/iotest"
+)
+
+// stubLookPath makes lookPath find only the executables in found.
+func stubLookPath(t *testing.T, found ...string) {
+	t.Helper()
+
+	previous := lookPath
+	lookPath = func(file string) (string, error) {
+		for _, f := range found {
+			if f == file {
+				return "/usr/bin/" + file, nil
+			}
+		}
+		return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+	}
+	t.Cleanup(func() { lookPath = previous })
+}
+
+func TestCheckFFmpeg(t *testing.T) {
+	previous := settings.FFmpegPath
+	t.Cleanup(func() { settings.FFmpegPath = previous })
+
+	settings.FFmpegPath = "ffmpeg"
+	stubLookPath(t, "ffmpeg")
+	if err := checkFFmpeg(); err != nil {
+		t.Errorf("checkFFmpeg with ffmpeg installed = %v", err)
+	}
+
+	stubLookPath(t)
+	err := checkFFmpeg()
+	if !errors.Is(err, errFFmpegMissing) {
+		t.Errorf("checkFFmpeg without ffmpeg = %v, want %v", err, errFFmpegMissing)
+	}
+
+	settings.FFmpegPath = "/opt/ffmpeg/bin/ffmpeg"
+	stubLookPath(t, "/opt/ffmpeg/bin/ffmpeg")
+	if err := checkFFmpeg(); err != nil {
+		t.Errorf("checkFFmpeg with FFMPEG_PATH set = %v", err)
+	}
+}
+
+// pcmBytes encodes samples as ffmpeg's s16le output.
+func pcmBytes(samples ...int16) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, samples)
+	return buf.Bytes()
+}
+
+func TestReadPCMFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		want    [][]int16
+		wantErr error
+	}{
+		{
+			name:    "whole frames",
+			input:   pcmBytes(1, -2, 3, -4),
+			want:    [][]int16{{1, -2}, {3, -4}},
+			wantErr: io.EOF,
+		},
+		{
+			name:    "partial final frame",
+			input:   pcmBytes(1, -2, 3),
+			want:    [][]int16{{1, -2}, {3, 0}},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "odd trailing byte",
+			input:   append(pcmBytes(1, -2, 3), 0x7f),
+			want:    [][]int16{{1, -2}, {3, 0}},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "single byte",
+			input:   []byte{0x7f},
+			want:    [][]int16{{0, 0}},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "empty",
+			wantErr: io.EOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Reading a byte at a time checks frames are assembled from
+			// short reads.
+			r := iotest.OneByteReader(bytes.NewReader(tt.input))
+			var got [][]int16
+			var err error
+			for {
+				pcm := []int16{99, 99}
+				err = readPCMFrame(r, pcm)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				got = append(got, pcm)
+				if err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("readPCMFrame ended with %v, want %v", err, tt.wantErr)
+			}
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("readPCMFrame read %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPCMFrameError(t *testing.T) {
+	broken := errors.New("broken pipe")
+	err := readPCMFrame(iotest.ErrReader(broken), make([]int16, 2))
+	if !errors.Is(err, broken) {
+		t.Errorf("readPCMFrame of a failing reader = %v, want %v", err, broken)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	maxAttachmentSize = 100 << 20
+	downloadTimeout   = time.Minute
+)
+
+// attachmentHosts are the Discord hosts that serve uploaded attachments.
+var attachmentHosts = map[string]bool{
+	"cdn.discordapp.com":   true,
+	"media.discordapp.net": true,
+}
+
+// tempAudioDir holds downloaded attachments while they play.
+var tempAudioDir = filepath.Join(os.TempDir(), "radio-bot")
+
+var downloadClient = newHTTPClient(http.DefaultTransport, downloadTimeout)
+
+var errOutsideAudioDir = errors.New("the file is outside the audio directory")
+
+// isAdmin reports whether the user may run admin-only commands.
+func isAdmin(s *discordgo.Session, r Responder) bool {
+	return slices.Contains(settings.AdminUserIDs, r.UserID()) || canManageGuild(s, r)
+}
+
+// isAttachmentURL reports whether rawURL is a Discord attachment.
+func isAttachmentURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && u.Scheme == "https" && attachmentHosts[u.Hostname()]
+}
+
+// resolveAudioFile returns the path of name inside settings.AudioFilesDir,
+// rejecting names that would escape it through ".." or symlinks.
+func resolveAudioFile(name string) (string, error) {
+	root, err := filepath.Abs(settings.AudioFilesDir)
+	if err != nil {
+		return "", err
+	}
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := filepath.EvalSymlinks(filepath.Join(root, filepath.Clean("/"+name)))
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errOutsideAudioDir
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", name)
+	}
+
+	return p, nil
+}
+
+// downloadAttachment saves a Discord attachment to a temporary file and
+// returns its path.
+func downloadAttachment(rawURL string) (string, error) {
+	resp, err := downloadClient.Get(rawURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("the attachment answered %s", resp.Status)
+	}
+	if resp.ContentLength > maxAttachmentSize {
+		return "", errors.New("the attachment is too large")
+	}
+
+	err = os.MkdirAll(tempAudioDir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	u, _ := url.Parse(rawURL)
+	f, err := os.CreateTemp(tempAudioDir, "*-"+path.Base(u.Path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, io.LimitReader(resp.Body, maxAttachmentSize+1))
+	if err == nil && n > maxAttachmentSize {
+		err = errors.New("the attachment is too large")
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// removeTempAudio deletes streamURL if it is a downloaded attachment.
+func removeTempAudio(streamURL string) {
+	if filepath.Dir(streamURL) != tempAudioDir {
+		return
+	}
+
+	err := os.Remove(streamURL)
+	if err != nil && !os.IsNotExist(err) {
+		log.Println("Error removing downloaded attachment:", err)
+	}
+}
+
+// removeQueuedTempAudio deletes the downloaded attachments among stations
+// taken off a queue without playing.
+func removeQueuedTempAudio(stations []RadioStation) {
+	for _, station := range stations {
+		removeTempAudio(station.URL)
+	}
+}
+
+// clearTempAudio deletes the attachments left over from a previous run,
+// which may have been stopped before it could remove them.
+func clearTempAudio() {
+	err := os.RemoveAll(tempAudioDir)
+	if err != nil {
+		log.Println("Error removing downloaded attachments:", err)
+	}
+}
+
+func handlePlayFile(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Usage: `%splayfile <path>`, or attach an audio file to the command.", commandPrefix(r.GuildID())))
+		return
+	}
+
+	if !isAdmin(s, r) {
+		r.ReplyError("Only server admins can play files.")
+		return
+	}
+
+	voiceChannelID, err := voiceChannelFor(s, r, "")
+	if err != nil {
+		replyNotInVoiceChannel(r)
+		return
+	}
+
+	var filePath string
+	if isAttachmentURL(args[0]) {
+		filePath, err = downloadAttachment(args[0])
+		if err != nil {
+			log.Println("Error downloading attachment:", err)
+			r.ReplyError(fmt.Sprintf("Could not download the attachment: %v.", err))
+			return
+		}
+	} else {
+		filePath, err = resolveAudioFile(strings.Join(args, " "))
+		if err != nil {
+			r.ReplyError(fmt.Sprintf("Could not open the file: %v.", err))
+			return
+		}
+	}
+
+	playRadioStream(s, r, RadioStation{Name: filepath.Base(filePath), URL: filePath}, voiceChannelID)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tempAudioFile fakes a downloaded attachment in a temporary tempAudioDir.
+func tempAudioFile(t *testing.T) string {
+	t.Helper()
+
+	previous := tempAudioDir
+	tempAudioDir = t.TempDir()
+	t.Cleanup(func() { tempAudioDir = previous })
+
+	f, err := os.CreateTemp(tempAudioDir, "*-song.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	return f.Name()
+}
+
+func checkRemoved(t *testing.T, path string) {
+	t.Helper()
+
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("the attachment is still there: %v", err)
+	}
+}
+
+func TestPlayRadioStreamRemovesUnplayedAttachment(t *testing.T) {
+	s := setupCommandTest(t)
+	path := tempAudioFile(t)
+
+	// The author isn't in a voice channel, so nothing plays.
+	r := &recordingResponder{guildID: "guild", userID: testManager, channelID: testTextChannel}
+	playRadioStream(s, r, RadioStation{Name: filepath.Base(path), URL: path}, "")
+	checkRemoved(t, path)
+}
+
+func TestClearRemovesQueuedAttachments(t *testing.T) {
+	s := setupCommandTest(t)
+	path := tempAudioFile(t)
+
+	conn := newTestConnection()
+	conn.vc.GuildID = "guild"
+	conn.queue.Push(RadioStation{Name: filepath.Base(path), URL: path})
+	guilds.Set("guild", conn)
+
+	runCommand(s, "guild", testManager, "clear")
+	checkRemoved(t, path)
+}
+
+func TestClearTempAudio(t *testing.T) {
+	path := tempAudioFile(t)
+
+	clearTempAudio()
+	checkRemoved(t, path)
+}
+
+func TestRemoveTempAudioKeepsOtherFiles(t *testing.T) {
+	tempAudioFile(t)
+	other := filepath.Join(t.TempDir(), "song.mp3")
+	if err := os.WriteFile(other, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	removeTempAudio(other)
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("removeTempAudio deleted a file outside tempAudioDir: %v", err)
+	}
+}
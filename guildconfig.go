@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// resetValue is the value that puts a guild setting back to its default.
+const resetValue = "default"
+
+const maxPrefixLength = 5
+
+var errUnknownSetting = errors.New("unknown setting")
+
+// guildSetting is a per-guild setting that can be viewed and changed with
+// !get and !set.
+type guildSetting struct {
+	key         string
+	description string
+	// get returns the value of the setting, or an empty string while it
+	// has its default.
+	get func(gs GuildSettings) string
+	// set validates value and stores it, returning the error shown to the
+	// user if it isn't valid.
+	set   func(gs *GuildSettings, value string) error
+	reset func(gs *GuildSettings)
+	// byDefault describes the default value.
+	byDefault func() string
+}
+
+// guildSettingsSchema lists the per-guild settings in the order !settings
+// shows them.
+var guildSettingsSchema = []guildSetting{
+	{
+		key:         "prefix",
+		description: "Prefix of text commands",
+		get:         func(gs GuildSettings) string { return gs.Prefix },
+		set: func(gs *GuildSettings, value string) error {
+			if len(value) > maxPrefixLength || strings.ContainsFunc(value, unicode.IsSpace) {
+				return fmt.Errorf("the prefix must be at most %d characters without spaces", maxPrefixLength)
+			}
+			gs.Prefix = value
+			return nil
+		},
+		reset:     func(gs *GuildSettings) { gs.Prefix = "" },
+		byDefault: defaultPrefix,
+	},
+	{
+		key:         "djrole",
+		description: "Role, by name or ID, allowed to use the restricted commands",
+		get:         func(gs GuildSettings) string { return gs.DJRole },
+		set: func(gs *GuildSettings, value string) error {
+			gs.DJRole = strings.TrimSuffix(strings.TrimPrefix(value, "<@&"), ">")
+			return nil
+		},
+		reset:     func(gs *GuildSettings) { gs.DJRole = "" },
+		byDefault: func() string { return "none, only Manage Server" },
+	},
+	{
+		key:         "volume",
+		description: "Volume new streams start at, in percent",
+		get: func(gs GuildSettings) string {
+			if gs.Volume == nil {
+				return ""
+			}
+			return fmt.Sprintf("%d%%", volumePercent(*gs.Volume))
+		},
+		set: func(gs *GuildSettings, value string) error {
+			percent, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+			if err != nil || percent < 0 || percent > settings.MaxVolume {
+				return fmt.Errorf("the volume must be between 0 and %d", settings.MaxVolume)
+			}
+			volume := float64(percent) / 100.0
+			gs.Volume = &volume
+			return nil
+		},
+		reset:     func(gs *GuildSettings) { gs.Volume = nil },
+		byDefault: func() string { return fmt.Sprintf("%d%%", settings.DefaultVolume) },
+	},
+	{
+		key:         "country",
+		description: "Country of the stations suggested by suggest",
+		get:         func(gs GuildSettings) string { return gs.Country },
+		set: func(gs *GuildSettings, value string) error {
+			gs.Country = value
+			return nil
+		},
+		reset:     func(gs *GuildSettings) { gs.Country = "" },
+		byDefault: func() string { return "everywhere" },
+	},
+	{
+		key:         "crossfade",
+		description: "Seconds stations crossfade over, 0 to turn it off",
+		get: func(gs GuildSettings) string {
+			if gs.Crossfade == 0 {
+				return ""
+			}
+			return strconv.Itoa(gs.Crossfade)
+		},
+		set: func(gs *GuildSettings, value string) error {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > maxCrossfade {
+				return fmt.Errorf("the crossfade must be between 0 and %d seconds", int(maxCrossfade.Seconds()))
+			}
+			gs.Crossfade = seconds
+			return nil
+		},
+		reset:     func(gs *GuildSettings) { gs.Crossfade = 0 },
+		byDefault: func() string { return "0" },
+	},
+}
+
+// findGuildSetting looks up a setting of the schema by its key, ignoring
+// case.
+func findGuildSetting(key string) (guildSetting, error) {
+	i := slices.IndexFunc(guildSettingsSchema, func(setting guildSetting) bool {
+		return strings.EqualFold(setting.key, key)
+	})
+	if i < 0 {
+		return guildSetting{}, fmt.Errorf("%w %q", errUnknownSetting, key)
+	}
+	return guildSettingsSchema[i], nil
+}
+
+// applyGuildSetting sets key to value in gs, or back to its default when
+// value is resetValue.
+func applyGuildSetting(gs *GuildSettings, key, value string) error {
+	setting, err := findGuildSetting(key)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(value, resetValue) {
+		setting.reset(gs)
+		return nil
+	}
+	return setting.set(gs, value)
+}
+
+// guildSettingLabel formats the value of a setting for display, marking
+// defaults.
+func guildSettingLabel(setting guildSetting, gs GuildSettings) string {
+	if value := setting.get(gs); value != "" {
+		return fmt.Sprintf("`%s`", value)
+	}
+	return fmt.Sprintf("`%s` (default)", setting.byDefault())
+}
+
+func settingKeyList() string {
+	keys := make([]string, len(guildSettingsSchema))
+	for i, setting := range guildSettingsSchema {
+		keys[i] = setting.key
+	}
+	return strings.Join(keys, ", ")
+}
+
+// guildSettingChoices returns the keys of the schema as slash command
+// choices.
+func guildSettingChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, len(guildSettingsSchema))
+	for i, setting := range guildSettingsSchema {
+		choices[i] = &discordgo.ApplicationCommandOptionChoice{Name: setting.key, Value: setting.key}
+	}
+	return choices
+}
+
+// changeGuildSetting sets key to value in the guild of the author like
+// !set, once it checked they may change server settings. It replies with
+// the reason when the setting wasn't changed, and reports whether it was.
+func changeGuildSetting(s *discordgo.Session, r Responder, key, value string) bool {
+	if !isAdmin(s, r) {
+		r.ReplyError("You need the Manage Server permission to change server settings.")
+		return false
+	}
+
+	guildSettingsMutex.Lock()
+	gs := guildSettings[r.GuildID()]
+	err := applyGuildSetting(&gs, key, value)
+	if err == nil {
+		guildSettings[r.GuildID()] = gs
+	}
+	guildSettingsMutex.Unlock()
+
+	if err != nil {
+		r.ReplyError(fmt.Sprintf("Invalid value for `%s`: %v.", key, err))
+		return false
+	}
+
+	saveGuildSettings()
+	return true
+}
+
+func handleSet(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 2 {
+		r.ReplyError(fmt.Sprintf("Usage: `%sset <key> <value|%s>`, keys are %s.", commandPrefix(r.GuildID()), resetValue, settingKeyList()))
+		return
+	}
+
+	setting, err := findGuildSetting(args[0])
+	if err != nil {
+		r.ReplyError(fmt.Sprintf("Unknown setting `%s`, keys are %s.", args[0], settingKeyList()))
+		return
+	}
+
+	if !changeGuildSetting(s, r, setting.key, strings.Join(args[1:], " ")) {
+		return
+	}
+
+	guildSettingsMutex.RLock()
+	gs := guildSettings[r.GuildID()]
+	guildSettingsMutex.RUnlock()
+
+	r.Reply(fmt.Sprintf("`%s` set to %s.", setting.key, guildSettingLabel(setting, gs)))
+}
+
+func handleGet(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		handleSettings(s, r, args)
+		return
+	}
+
+	setting, err := findGuildSetting(args[0])
+	if err != nil {
+		r.ReplyError(fmt.Sprintf("Unknown setting `%s`, keys are %s.", args[0], settingKeyList()))
+		return
+	}
+
+	guildSettingsMutex.RLock()
+	gs := guildSettings[r.GuildID()]
+	guildSettingsMutex.RUnlock()
+
+	r.Reply(fmt.Sprintf("`%s` is %s. %s.", setting.key, guildSettingLabel(setting, gs), setting.description))
+}
+
+func handleSettings(s *discordgo.Session, r Responder, args []string) {
+	guildSettingsMutex.RLock()
+	gs := guildSettings[r.GuildID()]
+	guildSettingsMutex.RUnlock()
+
+	var b strings.Builder
+	b.WriteString("**Server settings:**\n")
+	for _, setting := range guildSettingsSchema {
+		fmt.Fprintf(&b, "- `%s`: %s\n", setting.key, guildSettingLabel(setting, gs))
+	}
+	fmt.Fprintf(&b, "Change them with `%sset <key> <value>`, or `%[1]sset <key> %s` to go back to the default.", commandPrefix(r.GuildID()), resetValue)
+
+	replyChunked(r, b.String())
+}
@@ -0,0 +1,83 @@
+package main
+
+import "sync"
+
+// GuildManager tracks the connection of each guild. Every guild has its own
+// locks, so a slow voice join in one guild doesn't hold up the others.
+type GuildManager struct {
+	guilds sync.Map // guild ID -> *guildEntry
+}
+
+type guildEntry struct {
+	// op serializes starting and stopping streams in the guild.
+	op sync.Mutex
+
+	mu   sync.RWMutex
+	conn *Connection
+}
+
+func NewGuildManager() *GuildManager {
+	return &GuildManager{}
+}
+
+func (gm *GuildManager) entry(guildID string) *guildEntry {
+	if e, ok := gm.guilds.Load(guildID); ok {
+		return e.(*guildEntry)
+	}
+	e, _ := gm.guilds.LoadOrStore(guildID, &guildEntry{})
+	return e.(*guildEntry)
+}
+
+// Lock serializes stream changes in a guild until the returned function is
+// called. It doesn't block reading the guild's connection.
+func (gm *GuildManager) Lock(guildID string) (unlock func()) {
+	e := gm.entry(guildID)
+	e.op.Lock()
+	return e.op.Unlock
+}
+
+// Connection returns the connection of a guild, if there is one.
+func (gm *GuildManager) Connection(guildID string) (*Connection, bool) {
+	e := gm.entry(guildID)
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.conn, e.conn != nil
+}
+
+// Connections returns the connections of all guilds.
+func (gm *GuildManager) Connections() []*Connection {
+	var conns []*Connection
+	gm.guilds.Range(func(_, v any) bool {
+		e := v.(*guildEntry)
+		e.mu.RLock()
+		if e.conn != nil {
+			conns = append(conns, e.conn)
+		}
+		e.mu.RUnlock()
+		return true
+	})
+	return conns
+}
+
+// Set makes conn the connection of a guild.
+func (gm *GuildManager) Set(guildID string, conn *Connection) {
+	e := gm.entry(guildID)
+	e.mu.Lock()
+	e.conn = conn
+	e.mu.Unlock()
+}
+
+// Remove drops conn from its guild and reports whether it was still the
+// guild's connection.
+func (gm *GuildManager) Remove(guildID string, conn *Connection) bool {
+	e := gm.entry(guildID)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conn != conn {
+		return false
+	}
+	e.conn = nil
+	return true
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGuildManagerRemove(t *testing.T) {
+	gm := NewGuildManager()
+	old, current := &Connection{id: "old"}, &Connection{id: "current"}
+
+	gm.Set("guild", old)
+	gm.Set("guild", current)
+	if gm.Remove("guild", old) {
+		t.Error("Remove of a replaced connection = true")
+	}
+	if conn, ok := gm.Connection("guild"); !ok || conn != current {
+		t.Errorf("Connection after removing a replaced one = %v, %v, want the current one", conn, ok)
+	}
+	if !gm.Remove("guild", current) {
+		t.Error("Remove of the current connection = false")
+	}
+	if _, ok := gm.Connection("guild"); ok {
+		t.Error("the guild still has a connection after Remove")
+	}
+}
+
+// benchmarkGuilds is how many guilds the benchmarks spread commands over.
+const benchmarkGuilds = 1000
+
+func benchmarkGuildIDs() []string {
+	ids := make([]string, benchmarkGuilds)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i)
+	}
+	return ids
+}
+
+// joinTime stands for the voice join a play holds the lock across.
+const joinTime = 100 * time.Microsecond
+
+// benchmarkCommands runs commands from many goroutines, each in its own
+// guild. One in a hundred is a play, calling play with the guild ID, and the
+// rest read the connection of a guild with lookup, as most commands do.
+func benchmarkCommands(b *testing.B, play, lookup func(guildID string)) {
+	ids := benchmarkGuildIDs()
+	var next atomic.Int64
+
+	// The goroutines waiting on a join don't use a CPU, so run more of them
+	// than there are CPUs.
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(next.Add(1))
+		for n := 0; pb.Next(); n++ {
+			if n%100 == 0 {
+				play(ids[i%benchmarkGuilds])
+			} else {
+				lookup(ids[(i+n)%benchmarkGuilds])
+			}
+		}
+	})
+}
+
+func BenchmarkGuildManager(b *testing.B) {
+	gm := NewGuildManager()
+	benchmarkCommands(b, func(guildID string) {
+		unlock := gm.Lock(guildID)
+		defer unlock()
+
+		time.Sleep(joinTime)
+		gm.Set(guildID, &Connection{})
+	}, func(guildID string) {
+		gm.Connection(guildID)
+	})
+}
+
+func BenchmarkGlobalMutex(b *testing.B) {
+	var mu sync.Mutex
+	conns := make(map[string]*Connection)
+	benchmarkCommands(b, func(guildID string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		time.Sleep(joinTime)
+		conns[guildID] = &Connection{}
+	}, func(guildID string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		_ = conns[guildID]
+	})
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GuildSettings holds the per-guild overrides of the global settings.
+type GuildSettings struct {
+	Prefix      string        `json:"prefix,omitempty"`
+	DJRole      string        `json:"dj_role,omitempty"`
+	Crossfade   int           `json:"crossfade,omitempty"`
+	Volume      *float64      `json:"volume,omitempty"`
+	Country     string        `json:"country,omitempty"`
+	LastStation *RadioStation `json:"last_station,omitempty"`
+}
+
+var (
+	guildSettings      = make(map[string]GuildSettings)
+	guildSettingsMutex sync.RWMutex
+)
+
+// commandPrefix returns the prefix for text commands in a guild, falling
+// back to the configured default.
+func commandPrefix(guildID string) string {
+	guildSettingsMutex.RLock()
+	defer guildSettingsMutex.RUnlock()
+
+	if prefix := guildSettings[guildID].Prefix; prefix != "" {
+		return prefix
+	}
+	return defaultPrefix()
+}
+
+// lastStation returns the station that was last played in a guild.
+func lastStation(guildID string) (RadioStation, bool) {
+	guildSettingsMutex.RLock()
+	defer guildSettingsMutex.RUnlock()
+
+	station := guildSettings[guildID].LastStation
+	if station == nil {
+		return RadioStation{}, false
+	}
+	return *station, true
+}
+
+// setLastStation records the station played in a guild so it can be
+// replayed after it stops.
+func setLastStation(guildID string, station RadioStation) {
+	if guildID == "" {
+		return
+	}
+
+	guildSettingsMutex.Lock()
+	gs := guildSettings[guildID]
+	gs.LastStation = &station
+	guildSettings[guildID] = gs
+	guildSettingsMutex.Unlock()
+
+	saveGuildSettings()
+}
+
+// guildCountry returns the country a guild gets station suggestions from, or
+// an empty string for suggestions from everywhere.
+func guildCountry(guildID string) string {
+	guildSettingsMutex.RLock()
+	defer guildSettingsMutex.RUnlock()
+
+	return guildSettings[guildID].Country
+}
+
+// guildVolume returns the volume last set in a guild, or the DEFAULT_VOLUME
+// setting if it was never changed.
+func guildVolume(guildID string) float64 {
+	guildSettingsMutex.RLock()
+	defer guildSettingsMutex.RUnlock()
+
+	if volume := guildSettings[guildID].Volume; volume != nil {
+		return *volume
+	}
+	return float64(settings.DefaultVolume) / 100.0
+}
+
+// setGuildVolume remembers the volume set in a guild for its next streams.
+func setGuildVolume(guildID string, volume float64) {
+	if guildID == "" {
+		return
+	}
+
+	guildSettingsMutex.Lock()
+	gs := guildSettings[guildID]
+	gs.Volume = &volume
+	guildSettings[guildID] = gs
+	guildSettingsMutex.Unlock()
+
+	saveGuildSettings()
+}
+
+func saveGuildSettings() {
+	guildSettingsMutex.RLock()
+	defer guildSettingsMutex.RUnlock()
+
+	data, err := json.Marshal(guildSettings)
+	if err != nil {
+		log.Println("Error marshalling guild settings:", err)
+		return
+	}
+
+	err = os.WriteFile("guilds.json", data, 0644)
+	if err != nil {
+		log.Println("Error writing guild settings to file:", err)
+	}
+}
+
+func loadGuildSettings() {
+	data, err := os.ReadFile("guilds.json")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+		log.Println("Error reading guild settings file:", err)
+		return
+	}
+
+	guildSettingsMutex.Lock()
+	defer guildSettingsMutex.Unlock()
+
+	err = json.Unmarshal(data, &guildSettings)
+	if err != nil {
+		log.Println("Error unmarshalling guild settings:", err)
+	}
+
+	// The file may have been edited by hand or saved with a higher
+	// MAX_VOLUME than the current one.
+	maxVolume := float64(settings.MaxVolume) / 100.0
+	for guildID, gs := range guildSettings {
+		if gs.Volume == nil {
+			continue
+		}
+		volume := math.Max(0, math.Min(*gs.Volume, maxVolume))
+		gs.Volume = &volume
+		guildSettings[guildID] = gs
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// loaded is set once the stations, custom radios and guild settings were
+// loaded at startup.
+var loaded atomic.Bool
+
+type healthStatus struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// newHealthHandler returns the handler of the health checks. /healthz
+// answers as long as the process runs, and /readyz only once the bot has
+// loaded its data and is connected to the Discord gateway.
+func newHealthHandler(s *discordgo.Session) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, healthStatus{Status: "ok"})
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		reason := notReadyReason(s)
+		if reason != "" {
+			writeJSON(w, http.StatusServiceUnavailable, healthStatus{Status: "unavailable", Reason: reason})
+			return
+		}
+		writeJSON(w, http.StatusOK, healthStatus{Status: "ok"})
+	})
+	return mux
+}
+
+// notReadyReason returns why the bot can't serve commands yet, or an empty
+// string if it can.
+func notReadyReason(s *discordgo.Session) string {
+	if !loaded.Load() {
+		return "still loading"
+	}
+
+	s.RLock()
+	connected := s.DataReady
+	s.RUnlock()
+	if !connected || s.State.User == nil {
+		return "not connected to Discord"
+	}
+	return ""
+}
+
+// startHealthServer serves the health checks on settings.HealthAddr.
+func startHealthServer(s *discordgo.Session) {
+	log.Println("Health checks listening on", settings.HealthAddr)
+
+	err := http.ListenAndServe(settings.HealthAddr, newHealthHandler(s))
+	if err != nil {
+		log.Println("Error running health check server:", err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// icyClient has no timeout since the metadata connection stays open for as
+// long as the stream plays.
+var icyClient = newHTTPClient(guardedTransport, 0)
+
+// watchStreamTitle opens a separate connection to streamURL requesting ICY
+// metadata and calls onTitle every time the stream announces a new title. It
+// returns when quit is closed, the connection fails or the stream doesn't
+// send metadata.
+func watchStreamTitle(streamURL string, quit <-chan struct{}, onTitle func(string)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Icy-MetaData", "1")
+
+	resp, err := icyClient.Do(req)
+	if err != nil {
+		log.Debug("Error connecting for stream metadata: ", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	metaInt, err := strconv.Atoi(resp.Header.Get("Icy-Metaint"))
+	if err != nil || metaInt <= 0 {
+		log.Debug("Stream doesn't provide ICY metadata")
+		return
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		_, err = io.CopyN(io.Discard, reader, int64(metaInt))
+		if err != nil {
+			return
+		}
+
+		length, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		if length == 0 {
+			continue
+		}
+
+		meta := make([]byte, int(length)*16)
+		_, err = io.ReadFull(reader, meta)
+		if err != nil {
+			return
+		}
+
+		if title, ok := parseStreamTitle(string(meta)); ok {
+			onTitle(title)
+		}
+	}
+}
+
+// parseStreamTitle extracts the StreamTitle value from an ICY metadata block
+// such as "StreamTitle='Artist - Song';".
+func parseStreamTitle(meta string) (string, bool) {
+	const key = "StreamTitle='"
+
+	start := strings.Index(meta, key)
+	if start < 0 {
+		return "", false
+	}
+	meta = meta[start+len(key):]
+
+	end := strings.Index(meta, "';")
+	if end < 0 {
+		end = strings.LastIndex(meta, "'")
+		if end < 0 {
+			return "", false
+		}
+	}
+
+	return strings.TrimSpace(meta[:end]), true
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxImportRadios caps how many radios one import may add.
+	maxImportRadios = 100
+	maxImportSize   = 1 << 20
+	importTimeout   = 10 * time.Second
+	// maxImportErrors is how many failed entries an import lists.
+	maxImportErrors = 5
+)
+
+var importClient = newHTTPClient(guardedTransport, importTimeout)
+
+// importedRadio is an entry of a radio list to import.
+type importedRadio struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Category string `json:"category,omitempty"`
+}
+
+// parseRadioList parses a list of radios in one of the formats accepted by
+// !importradios: a JSON array of {"name", "url", "category"} objects, a JSON
+// object mapping names to URLs or to {"url", "category"} like !exportradios
+// writes, or CSV lines of name,url[,category] with an optional header.
+func parseRadioList(data []byte) ([]importedRadio, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("the list is empty")
+	}
+
+	switch data[0] {
+	case '[':
+		var radios []importedRadio
+		err := json.Unmarshal(data, &radios)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		return radios, nil
+	case '{':
+		return parseRadioMap(data)
+	}
+	return parseRadioCSV(data)
+}
+
+func parseRadioMap(data []byte) ([]importedRadio, error) {
+	var entries map[string]json.RawMessage
+	err := json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	var radios []importedRadio
+	for _, name := range slices.Sorted(maps.Keys(entries)) {
+		radio := importedRadio{Name: name}
+		var radioURL string
+		if json.Unmarshal(entries[name], &radioURL) == nil {
+			radio.URL = radioURL
+		} else {
+			var custom CustomRadio
+			err := json.Unmarshal(entries[name], &custom)
+			if err != nil {
+				return nil, fmt.Errorf("invalid entry for %q: %w", name, err)
+			}
+			radio.URL, radio.Category = custom.URL, custom.Category
+		}
+		radios = append(radios, radio)
+	}
+	return radios, nil
+}
+
+func parseRadioCSV(data []byte) ([]importedRadio, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(records) > 0 && len(records[0]) >= 2 && strings.EqualFold(records[0][0], "name") && strings.EqualFold(records[0][1], "url") {
+		records = records[1:]
+	}
+
+	var radios []importedRadio
+	for i, record := range records {
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d should be name,url[,category]", i+1)
+		}
+		radio := importedRadio{Name: record[0], URL: record[1]}
+		if len(record) > 2 {
+			radio.Category = record[2]
+		}
+		radios = append(radios, radio)
+	}
+	return radios, nil
+}
+
+// fetchRadioList downloads a radio list from an attachment or a public URL.
+func fetchRadioList(listURL string) ([]byte, error) {
+	if !isValidURL(listURL) {
+		return nil, errors.New("invalid URL")
+	}
+	err := checkStreamURL(listURL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := importClient.Get(listURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the URL answered %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImportSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImportSize {
+		return nil, errors.New("the list is too large")
+	}
+	return data, nil
+}
+
+// importRadio validates a radio of an imported list and saves it.
+func importRadio(radio importedRadio, probe bool) error {
+	name := normalizeRadioName(radio.Name)
+	if name == "" {
+		return errors.New("no name")
+	}
+	if _, ok := builtinRadio(name); ok {
+		return fmt.Errorf("`%s` is a built-in radio station", name)
+	}
+	if !isValidURL(radio.URL) {
+		return fmt.Errorf("`%s` has an invalid stream URL", name)
+	}
+	if err := checkStreamURL(radio.URL); err != nil {
+		return fmt.Errorf("`%s`: %v", name, err)
+	}
+	if probe {
+		if err := probeStream(radio.URL); err != nil {
+			return fmt.Errorf("`%s`: %v", name, err)
+		}
+	}
+
+	return store.SaveCustomRadio(name, CustomRadio{URL: radio.URL, Category: strings.TrimSpace(radio.Category)})
+}
+
+func handleImportRadios(s *discordgo.Session, r Responder, args []string) {
+	probe := false
+	if len(args) > 0 && strings.EqualFold(args[len(args)-1], "probe") {
+		probe = true
+		args = args[:len(args)-1]
+	}
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Usage: `%simportradios <url> [probe]`, or attach a JSON or CSV file to the command.", commandPrefix(r.GuildID())))
+		return
+	}
+
+	if !isAdmin(s, r) {
+		r.ReplyError("Only server admins can import radios.")
+		return
+	}
+
+	data, err := fetchRadioList(args[0])
+	if err != nil {
+		r.ReplyError(fmt.Sprintf("Couldn't download the radio list: %v.", err))
+		return
+	}
+
+	radios, err := parseRadioList(data)
+	if err != nil {
+		r.ReplyError(fmt.Sprintf("Couldn't read the radio list: %v.", err))
+		return
+	}
+	if len(radios) > maxImportRadios {
+		r.ReplyError(fmt.Sprintf("The list has %d radios, at most %d can be imported at once.", len(radios), maxImportRadios))
+		return
+	}
+
+	imported := 0
+	var failures []string
+	for _, radio := range radios {
+		err := importRadio(radio, probe)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		imported++
+	}
+	log.WithFields(log.Fields{"user": r.UserID(), "guild": r.GuildID()}).Printf("Imported %d of %d radios", imported, len(radios))
+
+	reply := fmt.Sprintf("Imported %d of %d radios.", imported, len(radios))
+	if len(failures) > 0 {
+		reply += fmt.Sprintf(" %d failed:", len(failures))
+		for _, failure := range failures[:min(len(failures), maxImportErrors)] {
+			reply += "\n- " + failure
+		}
+		if len(failures) > maxImportErrors {
+			reply += fmt.Sprintf("\n- and %d more", len(failures)-maxImportErrors)
+		}
+	}
+	r.Reply(reply)
+}
+
+func handleExportRadios(s *discordgo.Session, r Responder, args []string) {
+	radios := customRadios()
+	if len(radios) == 0 {
+		r.Reply("There are no custom radios to export.")
+		return
+	}
+
+	data, err := json.MarshalIndent(radios, "", "  ")
+	if err != nil {
+		log.Println("Error marshalling custom radios:", err)
+		r.ReplyError("Error exporting the custom radios.")
+		return
+	}
+
+	dm, err := s.UserChannelCreate(r.UserID())
+	if err == nil {
+		_, err = s.ChannelMessageSendComplex(dm.ID, &discordgo.MessageSend{
+			Content: fmt.Sprintf("The %d custom radios, which `%simportradios` can read back:", len(radios), commandPrefix(r.GuildID())),
+			Files:   []*discordgo.File{{Name: "radios.json", ContentType: "application/json", Reader: bytes.NewReader(data)}},
+		})
+	}
+	if err != nil {
+		log.WithField("user", r.UserID()).Println("Error sending exported radios:", err)
+		r.ReplyError("Couldn't send you a DM, check that you accept direct messages from server members.")
+		return
+	}
+
+	if r.GuildID() != "" {
+		r.Reply(fmt.Sprintf("Sent you the %d custom radios in a DM.", len(radios)))
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// idleVoiceConnection returns the voice connection of a guild the bot joined
+// without playing anything, if any.
+func idleVoiceConnection(s *discordgo.Session, guildID string) (*discordgo.VoiceConnection, bool) {
+	if _, ok := guilds.Connection(guildID); ok {
+		return nil, false
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	vc, ok := s.VoiceConnections[guildID]
+	return vc, ok
+}
+
+// leaveIfIdle disconnects from the voice channel of a guild if nothing
+// started playing there since the bot joined.
+func leaveIfIdle(s *discordgo.Session, guildID string) {
+	unlock := guilds.Lock(guildID)
+	defer unlock()
+
+	if vc, ok := idleVoiceConnection(s, guildID); ok {
+		log.WithField("guild", guildID).Println("Nothing played after joining, leaving the voice channel")
+		vc.Disconnect()
+	}
+}
+
+func handleJoin(s *discordgo.Session, r Responder, args []string) {
+	voiceChannelID, err := voiceChannelFor(s, r, "")
+	if err != nil {
+		r.ReplyError("You must be in a voice channel for me to join it.")
+		return
+	}
+
+	unlock := guilds.Lock(r.GuildID())
+	defer unlock()
+
+	if conn, ok := guilds.Connection(r.GuildID()); ok {
+		if conn.vc.ChannelID == voiceChannelID {
+			r.ReplyError("I'm already playing in your voice channel.")
+			return
+		}
+		r.ReplyError(fmt.Sprintf("I'm playing in another voice channel. Use `%smove` to bring the stream to yours.", commandPrefix(r.GuildID())))
+		return
+	}
+
+	if err := checkVoicePermissions(s, voiceChannelID); err != nil {
+		replyJoinError(r, err)
+		return
+	}
+
+	_, err = s.ChannelVoiceJoin(r.GuildID(), voiceChannelID, false, true)
+	if err != nil {
+		replyJoinError(r, err)
+		return
+	}
+
+	guildID := r.GuildID()
+	time.AfterFunc(idleTimeout, func() { leaveIfIdle(s, guildID) })
+
+	r.Reply(fmt.Sprintf("Joined your voice channel. I'll leave after %s unless something is played.", formatUptime(idleTimeout)))
+}
+
+// handleMove brings the stream to the caller's voice channel. The stream is
+// paused while the voice connection switches channels, so no audio is lost
+// and the stream doesn't restart.
+func handleMove(s *discordgo.Session, r Responder, args []string) {
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError(fmt.Sprintf("Nothing is playing. Use `%sjoin` to bring me to your channel.", commandPrefix(r.GuildID())))
+		return
+	}
+
+	voiceChannelID, err := voiceChannelFor(s, r, "")
+	if err != nil {
+		r.ReplyError("You must be in a voice channel to move the stream there.")
+		return
+	}
+	if conn.vc.ChannelID == voiceChannelID {
+		r.ReplyError("The stream is already in your voice channel.")
+		return
+	}
+
+	if err := checkVoicePermissions(s, voiceChannelID); err != nil {
+		replyJoinError(r, err)
+		return
+	}
+
+	unlock := guilds.Lock(r.GuildID())
+	defer unlock()
+
+	paused := conn.setPaused(true)
+	// The connection is reused, so joining the new channel moves it.
+	_, err = s.ChannelVoiceJoin(r.GuildID(), voiceChannelID, false, true)
+	if paused {
+		conn.setPaused(false)
+	}
+	if err != nil {
+		conn.logger().Println("Error moving to voice channel:", err)
+		r.ReplyError("Error moving to your voice channel.")
+		return
+	}
+
+	movePlayback(r.GuildID(), voiceChannelID)
+	conn.updateBitrate(s, voiceChannelID)
+	conn.logger().Println("Moved to voice channel ", voiceChannelID)
+	r.Reply("Moved the stream to your voice channel.")
+}
+
+// handleLeave stops the stream like !stop, and also leaves a channel the bot
+// joined without playing.
+func handleLeave(s *discordgo.Session, r Responder, args []string) {
+	if conn, ok := activeConnection(r.GuildID()); ok && stopConnection(s, conn) {
+		r.Reply("Stopped playing and left the voice channel.")
+		return
+	}
+
+	unlock := guilds.Lock(r.GuildID())
+	defer unlock()
+
+	vc, ok := idleVoiceConnection(s, r.GuildID())
+	if !ok {
+		r.ReplyError("I'm not in a voice channel.")
+		return
+	}
+
+	err := vc.Disconnect()
+	if err != nil {
+		log.Println("Error disconnecting from voice channel:", err)
+	}
+	r.Reply("Left the voice channel.")
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// jsonStore keeps the custom radios and favorites in memory and writes them
+// to JSON files on every change. It is not safe to share the files between
+// several bot instances.
+type jsonStore struct {
+	radiosPath    string
+	favoritesPath string
+
+	mu        sync.RWMutex
+	radios    map[string]CustomRadio
+	favorites map[string][]string
+}
+
+func newJSONStore(radiosPath, favoritesPath string) (*jsonStore, error) {
+	js := &jsonStore{
+		radiosPath:    radiosPath,
+		favoritesPath: favoritesPath,
+		radios:        make(map[string]CustomRadio),
+		favorites:     make(map[string][]string),
+	}
+
+	err := readRadiosFile(radiosPath, js.radios)
+	if err != nil {
+		return nil, err
+	}
+	err = readJSONFile(favoritesPath, &js.favorites)
+	if err != nil {
+		return nil, err
+	}
+
+	return js, nil
+}
+
+func (js *jsonStore) Reload() error {
+	radios := make(map[string]CustomRadio)
+	err := readRadiosFile(js.radiosPath, radios)
+	if err != nil {
+		return err
+	}
+	favorites := make(map[string][]string)
+	err = readJSONFile(js.favoritesPath, &favorites)
+	if err != nil {
+		return err
+	}
+
+	js.mu.Lock()
+	js.radios = radios
+	js.favorites = favorites
+	js.mu.Unlock()
+
+	return nil
+}
+
+// readJSONFile decodes the file at path into v, leaving v untouched if the
+// file doesn't exist yet.
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// readRadiosFile reads the custom radios at path into radios. Files written
+// before radios had categories map names straight to URLs, and are rewritten
+// in the current shape.
+func readRadiosFile(path string, radios map[string]CustomRadio) error {
+	var raw map[string]json.RawMessage
+	err := readJSONFile(path, &raw)
+	if err != nil {
+		return err
+	}
+
+	migrated := false
+	for name, value := range raw {
+		var streamURL string
+		if json.Unmarshal(value, &streamURL) == nil {
+			radios[name] = CustomRadio{URL: streamURL}
+			migrated = true
+			continue
+		}
+
+		var radio CustomRadio
+		err = json.Unmarshal(value, &radio)
+		if err != nil {
+			return fmt.Errorf("error reading radio %q: %w", name, err)
+		}
+		radios[name] = radio
+	}
+
+	if !migrated {
+		return nil
+	}
+	log.Printf("Migrating %s to store radio categories", path)
+	return writeJSONFile(path, radios)
+}
+
+func writeJSONFile(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+func (js *jsonStore) CustomRadio(name string) (CustomRadio, bool, error) {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+
+	radio, ok := js.radios[name]
+	return radio, ok, nil
+}
+
+func (js *jsonStore) ListCustomRadios() (map[string]CustomRadio, error) {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+
+	return maps.Clone(js.radios), nil
+}
+
+func (js *jsonStore) SaveCustomRadio(name string, radio CustomRadio) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	js.radios[name] = radio
+	return writeJSONFile(js.radiosPath, js.radios)
+}
+
+func (js *jsonStore) DeleteCustomRadio(name string) (bool, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	if _, ok := js.radios[name]; !ok {
+		return false, nil
+	}
+	delete(js.radios, name)
+	return true, writeJSONFile(js.radiosPath, js.radios)
+}
+
+func (js *jsonStore) RenameCustomRadio(oldName, newName string) (bool, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	radio, ok := js.radios[oldName]
+	if !ok {
+		return false, nil
+	}
+	if _, ok := js.radios[newName]; ok {
+		return false, errRadioExists
+	}
+	delete(js.radios, oldName)
+	js.radios[newName] = radio
+
+	renamed := false
+	for userID, names := range js.favorites {
+		i := slices.Index(names, oldName)
+		if i < 0 {
+			continue
+		}
+		if slices.Contains(names, newName) {
+			names = slices.Delete(names, i, i+1)
+		} else {
+			names[i] = newName
+		}
+		js.favorites[userID] = names
+		renamed = true
+	}
+
+	err := writeJSONFile(js.radiosPath, js.radios)
+	if err != nil {
+		return true, err
+	}
+	if renamed {
+		err = writeJSONFile(js.favoritesPath, js.favorites)
+	}
+	return true, err
+}
+
+func (js *jsonStore) ListFavorites(userID string) ([]string, error) {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+
+	return slices.Clone(js.favorites[userID]), nil
+}
+
+func (js *jsonStore) SaveFavorite(userID, radioName string) (bool, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	if slices.Contains(js.favorites[userID], radioName) {
+		return false, nil
+	}
+	js.favorites[userID] = append(js.favorites[userID], radioName)
+	return true, writeJSONFile(js.favoritesPath, js.favorites)
+}
+
+func (js *jsonStore) DeleteFavorite(userID, radioName string) (bool, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	i := slices.Index(js.favorites[userID], radioName)
+	if i < 0 {
+		return false, nil
+	}
+	js.favorites[userID] = slices.Delete(js.favorites[userID], i, i+1)
+	if len(js.favorites[userID]) == 0 {
+		delete(js.favorites, userID)
+	}
+	return true, writeJSONFile(js.favoritesPath, js.favorites)
+}
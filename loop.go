@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// loopMode controls what happens when a station finishes playing.
+type loopMode int
+
+const (
+	// loopOff advances the queue, or disconnects when it is empty.
+	loopOff loopMode = iota
+	// loopTrack restarts the current station.
+	loopTrack
+	// loopQueue sends the current station to the back of the queue, so
+	// the queue repeats.
+	loopQueue
+)
+
+var loopModes = map[string]loopMode{
+	"off":   loopOff,
+	"on":    loopTrack,
+	"track": loopTrack,
+	"queue": loopQueue,
+}
+
+func (m loopMode) String() string {
+	switch m {
+	case loopTrack:
+		return "track"
+	case loopQueue:
+		return "queue"
+	default:
+		return "off"
+	}
+}
+
+func (c *Connection) loopMode() loopMode {
+	c.loopMu.Lock()
+	defer c.loopMu.Unlock()
+
+	return c.loop
+}
+
+// setLoopMode changes the loop mode and reports whether it changed.
+func (c *Connection) setLoopMode(mode loopMode) bool {
+	c.loopMu.Lock()
+	defer c.loopMu.Unlock()
+
+	if c.loop == mode {
+		return false
+	}
+	c.loop = mode
+	return true
+}
+
+func handleLoop(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Usage: `%sloop <on|queue|off>`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	mode, ok := loopModes[strings.ToLower(args[0])]
+	if !ok {
+		r.ReplyError("Loop must be `on`, `queue` or `off`.")
+		return
+	}
+
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	if !conn.setLoopMode(mode) {
+		r.Reply(fmt.Sprintf("Loop is already %s.", mode))
+		return
+	}
+
+	switch mode {
+	case loopTrack:
+		r.Reply("Looping the current station.")
+	case loopQueue:
+		r.Reply("Looping the queue.")
+	default:
+		r.Reply("Loop turned off.")
+	}
+}
@@ -1,28 +1,27 @@
 package main
 
 import (
-	"bufio"
-	"encoding/binary"
-	"encoding/json"
-	"fmt"
-	"io"
+	"errors"
 	"net/http"
-	"net/url"
 	"os"
-	"os/exec"
+	"os/signal"
 	"radio-bot/server/config"
-	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	_ "github.com/joho/godotenv/autoload"
 	log "github.com/sirupsen/logrus"
-	"layeh.com/gopus"
 )
 
 const (
+	idleTimeout = 2 * time.Minute
+
+	searchLimit    = 50
+	searchPageSize = 10
+
 	channels  int = 2
 	frameRate int = 48000
 	frameSize int = 960
@@ -30,494 +29,215 @@ const (
 )
 
 type RadioStation struct {
-	Name string `json:"name"`
-	URL  string `json:"url"`
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+	Votes      int    `json:"votes,omitempty"`
+	ClickCount int    `json:"clickcount,omitempty"`
+	Favicon    string `json:"favicon,omitempty"`
+	Homepage   string `json:"homepage,omitempty"`
 }
 
 type Connection struct {
+	id        string
 	vc        *discordgo.VoiceConnection
 	stop      chan struct{}
 	done      chan struct{}
+	skip      chan struct{}
+	swap      chan AudioSource
+	queue     *Queue
+	channelID string
+	radioName string
+	streamURL string
+	live      bool
+	title     string
+	startedAt time.Time
+	stationMu sync.RWMutex
 	streaming bool
 	volume    float64
 	volumeMu  sync.RWMutex
 	paused    bool
+	resume    chan struct{}
+	pausedAt  time.Time
 	pauseMu   sync.Mutex
-}
 
-var (
-	connections = make(map[string]*Connection)
-	mutex       sync.Mutex
-
-	streamURLs = map[string]string{}
+	pauseTimer *time.Timer
 
-	customRadios      = make(map[string]string)
-	customRadiosMutex sync.RWMutex
+	normalize   bool
+	normalizeMu sync.Mutex
 
-	searchResults      = make(map[string][]RadioStation)
-	searchResultsMutex sync.Mutex
-)
-
-func main() {
-	settings, err := config.LoadSettings()
-	if err != nil {
-		log.Fatal("Error loading settings: ", err)
-	}
-	log.SetLevel(log.Level(settings.LogLevel))
+	sleepTimer *time.Timer
+	sleepMu    sync.Mutex
 
-	dg, err := discordgo.New("Bot " + settings.DiscordToken)
-	if err != nil {
-		log.Fatal("Error creating Discord session: ", err)
-	}
-	log.Debug("Discord session created")
+	skipVotes   map[string]bool
+	skipVotesAt time.Time
+	skipVotesMu sync.Mutex
 
-	dg.AddHandler(onMessageCreate)
+	controlMessageID string
+	controlMu        sync.Mutex
 
-	err = dg.Open()
-	if err != nil {
-		log.Fatal("Error opening connection to Discord: ", err)
-	}
-	defer dg.Close()
+	disconnectOnce sync.Once
 
-	loadCustomRadios()
+	loop   loopMode
+	loopMu sync.Mutex
 
-	log.Println("Bot is running. Press CTRL+C to exit.")
-	select {}
-}
+	// playedFrames counts the frames of the current source sent, starting
+	// from the position it was seeked to.
+	playedFrames atomic.Int64
 
-func onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
+	// decoding is set while a stream is read and can be restarted in place,
+	// which it can't between stations, during announcements or while
+	// reconnecting.
+	decoding atomic.Bool
 
-	if m.Author.ID == s.State.User.ID {
-		return
-	}
+	// bitrate is the Opus bitrate for the voice channel, see updateBitrate.
+	bitrate atomic.Int64
 
-	if m.Content == "!help" {
-		helpMessage := "**Available Commands:**\n" +
-			"- `!playradio <radio_name>`: Play a predefined or custom radio station.\n" +
-			"- `!stop`: Stop playing and disconnect the bot from the voice channel.\n" +
-			"- `!listradios`: List all available radio stations.\n" +
-			"- `!volume <0-100>`: Set the volume level.\n" +
-			"- `!searchradio <keywords>`: Search for radio stations by keywords.\n" +
-			"- `!playstation <number>`: Play a radio station from the search results.\n" +
-			"- `!addradio <stream_url> <radio_name>`: Add a custom radio station.\n" +
-			"- `!help`: Display this help message."
-
-		s.ChannelMessageSend(m.ChannelID, helpMessage)
-		return
-	}
+	// reconnectFailures counts the consecutive reconnects of the current
+	// station, until it plays steadily again. troubleNotified is set once
+	// the channel was told about them.
+	reconnectFailures atomic.Int32
+	troubleNotified   atomic.Bool
 
-	if strings.HasPrefix(m.Content, "!playradio") {
-		args := strings.Fields(m.Content)
-		if len(args) < 2 {
-			s.ChannelMessageSend(m.ChannelID, "Please specify a radio to play. For example: `!playradio gaucha`")
-			return
-		}
-
-		radioName := strings.ToLower(args[1])
-
-		streamURL, ok := streamURLs[radioName]
-		if !ok {
-			customRadiosMutex.RLock()
-			streamURL, ok = customRadios[radioName]
-			customRadiosMutex.RUnlock()
-			if !ok {
-				s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Unknown radio station: %s", radioName))
-				return
-			}
-		}
-
-		playRadioStream(s, m, streamURL, radioName)
-	} else if m.Content == "!stop" {
-
-		mutex.Lock()
-		conn, ok := connections[m.GuildID]
-		if !ok || !conn.streaming {
-			mutex.Unlock()
-			s.ChannelMessageSend(m.ChannelID, "Nothing is playing.")
-			return
-		}
-
-		close(conn.stop)
-		<-conn.done
-		delete(connections, m.GuildID)
-		mutex.Unlock()
-
-		s.ChannelMessageSend(m.ChannelID, "Stopped playing.")
-	} else if m.Content == "!listradios" {
-
-		radios := make([]string, 0, len(streamURLs))
-		for name := range streamURLs {
-			radios = append(radios, name)
-		}
-		customRadiosMutex.RLock()
-		for name := range customRadios {
-			radios = append(radios, name)
-		}
-		customRadiosMutex.RUnlock()
-		s.ChannelMessageSend(m.ChannelID, "Available radios: "+strings.Join(radios, ", "))
-	} else if strings.HasPrefix(m.Content, "!volume") {
-
-		args := strings.Fields(m.Content)
-		if len(args) < 2 {
-			s.ChannelMessageSend(m.ChannelID, "Please specify a volume level between 0 and 100.")
-			return
-		}
-
-		volumeStr := args[1]
-		volumeValue, err := strconv.Atoi(volumeStr)
-		if err != nil || volumeValue < 0 || volumeValue > 100 {
-			s.ChannelMessageSend(m.ChannelID, "Volume must be a number between 0 and 100.")
-			return
-		}
-
-		mutex.Lock()
-		conn, ok := connections[m.GuildID]
-		mutex.Unlock()
-		if !ok || !conn.streaming {
-			s.ChannelMessageSend(m.ChannelID, "Nothing is playing.")
-			return
-		}
-
-		conn.volumeMu.Lock()
-		conn.volume = float64(volumeValue) / 100.0
-		conn.volumeMu.Unlock()
-
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Volume set to %d%%.", volumeValue))
-	} else if strings.HasPrefix(m.Content, "!searchradio") {
-		args := strings.Fields(m.Content)
-		if len(args) < 2 {
-			s.ChannelMessageSend(m.ChannelID, "Please provide keywords to search for radio stations.")
-			return
-		}
-
-		query := strings.Join(args[1:], " ")
-		stations, err := searchRadioStations(query)
-		if err != nil {
-			s.ChannelMessageSend(m.ChannelID, "Error searching for radio stations.")
-			log.Println("Error searching for radio stations:", err)
-			return
-		}
-
-		if len(stations) == 0 {
-			s.ChannelMessageSend(m.ChannelID, "No radio stations found for your query.")
-			return
-		}
-
-		response := "Found the following stations:\n"
-		for i, station := range stations {
-			response += fmt.Sprintf("%d. %s\n", i+1, station.Name)
-			if i >= 9 {
-				break
-			}
-		}
-		response += "\nUse `!playstation <number>` to play a station."
-
-		s.ChannelMessageSend(m.ChannelID, response)
-
-		searchResultsMutex.Lock()
-		searchResults[m.Author.ID] = stations
-		searchResultsMutex.Unlock()
-	} else if strings.HasPrefix(m.Content, "!playstation") {
-		args := strings.Fields(m.Content)
-		if len(args) < 2 {
-			s.ChannelMessageSend(m.ChannelID, "Please specify the number of the station to play.")
-			return
-		}
-
-		index, err := strconv.Atoi(args[1])
-		if err != nil {
-			s.ChannelMessageSend(m.ChannelID, "Invalid station number.")
-			return
-		}
-
-		searchResultsMutex.Lock()
-		stations, ok := searchResults[m.Author.ID]
-		searchResultsMutex.Unlock()
-		if !ok || len(stations) == 0 {
-			s.ChannelMessageSend(m.ChannelID, "No search results found. Use `!searchradio` to search for stations.")
-			return
-		}
-
-		if index < 1 || index > len(stations) {
-			s.ChannelMessageSend(m.ChannelID, "Station number out of range.")
-			return
-		}
-
-		station := stations[index-1]
-		streamURL := station.URL
-
-		playRadioStream(s, m, streamURL, station.Name)
-	} else if strings.HasPrefix(m.Content, "!addradio") {
-
-		args := strings.Fields(m.Content)
-		if len(args) < 3 {
-			s.ChannelMessageSend(m.ChannelID, "Usage: `!addradio <stream_url> <radio_name>`")
-			return
-		}
-
-		streamURL := args[1]
-		radioName := strings.ToLower(args[2])
-
-		if !isValidURL(streamURL) {
-			s.ChannelMessageSend(m.ChannelID, "Invalid stream URL.")
-			return
-		}
-
-		customRadiosMutex.Lock()
-		customRadios[radioName] = streamURL
-		customRadiosMutex.Unlock()
-
-		saveCustomRadios()
-
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Custom radio `%s` added.", radioName))
-	} else if strings.HasPrefix(m.Content, "!") {
-		s.ChannelMessageSend(m.ChannelID, "Unknown command. Use `!help` to see the list of available commands.")
-	}
+	// While muted, volume is 0 and preMuteVolume is the volume to restore.
+	// Both are guarded by volumeMu.
+	muted         bool
+	preMuteVolume float64
 }
 
-func playRadioStream(s *discordgo.Session, m *discordgo.MessageCreate, streamURL, radioName string) {
-	voiceChannelID := getUserVoiceChannelID(s, m.GuildID, m.Author.ID)
-	if voiceChannelID == "" {
-		s.ChannelMessageSend(m.ChannelID, "You must be in a voice channel to use this command.")
-		return
-	}
+var (
+	settings config.Settings
 
-	mutex.Lock()
+	guilds = NewGuildManager()
 
-	if conn, ok := connections[m.GuildID]; ok {
-		close(conn.stop)
-		<-conn.done
-		delete(connections, m.GuildID)
-	}
+	searchResults      = make(map[string]*SearchResults)
+	searchResultsMutex sync.Mutex
 
-	vc, err := s.ChannelVoiceJoin(m.GuildID, voiceChannelID, false, true)
+	errStreamStopped     = errors.New("stream stopped")
+	errStreamSkipped     = errors.New("stream skipped")
+	errVoiceNotReady     = errors.New("Discord voice connection is not ready")
+	errNotInVoiceChannel = errors.New("not in a voice channel")
+	errEncoding          = errors.New("error encoding audio")
+	errNotDecoding       = errors.New("no stream is being read")
+)
+
+func main() {
+	var err error
+	settings, err = config.LoadSettings()
 	if err != nil {
-		log.Println("Error joining voice channel:", err)
-		s.ChannelMessageSend(m.ChannelID, "Error joining voice channel.")
-		mutex.Unlock()
-		return
+		log.Fatal("Error loading settings: ", err)
 	}
-
-	stop := make(chan struct{})
-	done := make(chan struct{})
-	conn := &Connection{
-		vc:        vc,
-		stop:      stop,
-		done:      done,
-		streaming: true,
-		volume:    1.0,
+	log.SetLevel(log.Level(settings.LogLevel))
+	if config.LogFormat(settings.LogFormat) == config.LogFormatJSON {
+		log.SetFormatter(&log.JSONFormatter{})
 	}
-	connections[m.GuildID] = conn
-	mutex.Unlock()
-
-	go streamAudio(s, conn, streamURL)
+	log.Println("Starting", buildInfo())
+	commandLimiter = newRateLimiter(settings.CommandInterval, settings.CommandBurst)
+	searchResultsCache = newSearchCache(settings.SearchCacheTTL, settings.SearchCacheSize)
 
-	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Now playing radio: %s", radioName))
-}
+	err = checkFFmpeg()
+	if err != nil {
+		log.Fatal("Install ffmpeg or set FFMPEG_PATH: ", err)
+	}
 
-func getUserVoiceChannelID(s *discordgo.Session, guildID, userID string) string {
+	clearTempAudio()
 
-	guild, err := s.State.Guild(guildID)
+	err = startStreamProxy()
 	if err != nil {
-
-		guild, err = s.Guild(guildID)
-		if err != nil {
-			log.Println("Error getting guild:", err)
-			return ""
-		}
+		log.Fatal("Error starting stream proxy: ", err)
 	}
 
-	for _, vs := range guild.VoiceStates {
-		if vs.UserID == userID {
-			return vs.ChannelID
-		}
+	store, err = openStore(config.StoreDriver(settings.Store), settings.DatabasePath)
+	if err != nil {
+		log.Fatal("Error opening store: ", err)
 	}
 
-	return ""
-}
-
-func streamAudio(s *discordgo.Session, conn *Connection, streamURL string) {
-	defer close(conn.done)
-	defer conn.vc.Disconnect()
-
-	vc := conn.vc
-
-	log.Println("Starting audio stream...")
-
-	ffmpeg := exec.Command(
-		"ffmpeg",
-		"-i", streamURL,
-		"-f", "s16le",
-		"-ar", fmt.Sprint(frameRate),
-		"-ac", fmt.Sprint(channels),
-		"pipe:1",
-	)
-	ffmpeg.Stderr = os.Stderr
-
-	ffmpegOut, err := ffmpeg.StdoutPipe()
+	publisher, err = openPublisher(config.EventBroker(settings.EventBroker), settings.EventBrokerURL, settings.EventSubject)
 	if err != nil {
-		log.Println("Error getting ffmpeg stdout:", err)
-		return
+		log.Fatal("Error opening event publisher: ", err)
 	}
 
-	err = ffmpeg.Start()
+	n, err := loadStations()
 	if err != nil {
-		log.Println("Error starting ffmpeg:", err)
-		return
+		log.Println("Error loading stations, starting without built-in stations:", err)
+	} else {
+		log.Printf("Loaded %d built-in stations from %s", n, settings.StationsFile)
 	}
 
-	buffer := bufio.NewReaderSize(ffmpegOut, 16384)
-
-	opusEncoder, err := gopus.NewEncoder(frameRate, channels, gopus.Audio)
+	dg, err := discordgo.New("Bot " + settings.DiscordToken)
 	if err != nil {
-		log.Fatal("NewEncoder Error: ", err)
+		log.Fatal("Error creating Discord session: ", err)
 	}
+	log.Debug("Discord session created")
 
-	vc.Speaking(true)
-	defer vc.Speaking(false)
-
-	errChan := make(chan error, 1)
-
-	go func() {
-		defer conn.vc.Disconnect()
-		for {
-			select {
-			case <-conn.stop:
-				log.Println("Stopping stream...")
-				return
-			default:
-				conn.pauseMu.Lock()
-				paused := conn.paused
-				conn.pauseMu.Unlock()
-				if paused {
-					time.Sleep(1 * time.Second)
-					continue
-				}
-
-				pcm := make([]int16, frameSize*channels)
-				err = binary.Read(buffer, binary.LittleEndian, &pcm)
-				if err != nil {
-					if err == io.EOF {
-						log.Println("Stream ended")
-					} else {
-						log.Println("Error reading stream data: ", err)
-					}
-					errChan <- err
-					return
-				}
-
-				conn.volumeMu.RLock()
-				volume := conn.volume
-				conn.volumeMu.RUnlock()
-
-				for i := range pcm {
-					sample := float64(pcm[i]) * volume
-					if sample > 32767 {
-						sample = 32767
-					} else if sample < -32768 {
-						sample = -32768
-					}
-					pcm[i] = int16(sample)
-				}
-
-				opusData, err := opusEncoder.Encode(pcm, frameSize, maxBytes)
-				if err != nil {
-					log.Println("Error encoding PCM to Opus: ", err)
-					errChan <- err
-					return
-				}
-
-				if !vc.Ready || vc.OpusSend == nil {
-					log.Println("Discord voice connection is not ready")
-					errChan <- fmt.Errorf("Discord voice connection is not ready")
-					return
-				}
-				vc.OpusSend <- opusData
-			}
-		}
-	}()
-
-	log.Println("Streaming started")
-
-	select {
-	case <-conn.stop:
-		log.Println("Stream stopped by user")
-	case err := <-errChan:
-		log.Println("Stream stopped due to error:", err)
+	// Check the token up front, since the gateway only reports a rejected
+	// token as a closed connection.
+	_, err = dg.User("@me")
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Response.StatusCode == http.StatusUnauthorized {
+		log.Fatal("Discord rejected DISCORD_TOKEN, reset the bot token in the Discord Developer Portal and update it")
 	}
 
-	ffmpeg.Process.Kill()
-	ffmpeg.Wait()
-}
+	// Serve the health checks right away, so liveness probes pass while
+	// the bot connects.
+	if settings.HealthAddr != "" {
+		go startHealthServer(dg)
+	}
 
-func searchRadioStations(query string) ([]RadioStation, error) {
-	apiURL := "https://de1.api.radio-browser.info/json/stations/search"
-	params := url.Values{}
-	params.Set("name", query)
-	params.Set("limit", "10")
+	dg.AddHandler(onMessageCreate)
+	dg.AddHandler(onInteractionCreate)
+	dg.AddHandler(onMessageReactionAdd)
 
-	resp, err := http.Get(apiURL + "?" + params.Encode())
+	err = dg.Open()
 	if err != nil {
-		return nil, err
+		log.Fatal("Error opening connection to Discord: ", err)
 	}
-	defer resp.Body.Close()
+	defer dg.Close()
 
-	var stations []struct {
-		Name        string `json:"name"`
-		URLResolved string `json:"url_resolved"`
-	}
-	err = json.NewDecoder(resp.Body).Decode(&stations)
-	if err != nil {
-		return nil, err
+	registerSlashCommands(dg)
+
+	loadGuildSettings()
+	loadPlaybackStates()
+	loadStats()
+	go flushStats()
+	go expireSearchResults()
+	loaded.Store(true)
+
+	if settings.AutoResume {
+		go resumePlayback(dg)
 	}
 
-	result := make([]RadioStation, len(stations))
-	for i, s := range stations {
-		result[i] = RadioStation{
-			Name: s.Name,
-			URL:  s.URLResolved,
-		}
+	if settings.HTTPAddr != "" {
+		go startHTTPServer(dg)
 	}
 
-	return result, nil
-}
+	log.Println("Bot is running. Press CTRL+C to exit.")
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	<-sc
 
-func isValidURL(u string) bool {
-	_, err := url.ParseRequestURI(u)
-	return err == nil
+	log.Println("Shutting down...")
+	saveStats()
+	err = dg.UpdateGameStatus(0, "")
+	if err != nil {
+		log.Println("Error clearing presence:", err)
+	}
 }
 
-func saveCustomRadios() {
-	customRadiosMutex.RLock()
-	defer customRadiosMutex.RUnlock()
+func onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 
-	data, err := json.Marshal(customRadios)
-	if err != nil {
-		log.Println("Error marshalling custom radios:", err)
+	if m.Author.ID == s.State.User.ID {
 		return
 	}
 
-	err = os.WriteFile("radios.json", data, 0644)
-	if err != nil {
-		log.Println("Error writing custom radios to file:", err)
-	}
-}
-
-func loadCustomRadios() {
-	data, err := os.ReadFile("radios.json")
-	if err != nil {
-		if os.IsNotExist(err) {
-			return
-		}
-		log.Println("Error reading custom radios file:", err)
+	name, args, ok := parseCommand(m.Content, commandPrefix(m.GuildID))
+	if !ok {
 		return
 	}
 
-	customRadiosMutex.Lock()
-	defer customRadiosMutex.Unlock()
-
-	err = json.Unmarshal(data, &customRadios)
-	if err != nil {
-		log.Println("Error unmarshalling custom radios:", err)
+	// An attached file is passed to !playfile and !importradios by URL.
+	if (name == "playfile" || name == "importradios") && len(m.Attachments) > 0 {
+		args = append(args, m.Attachments[0].URL)
 	}
+
+	handleCommand(s, &messageResponder{s: s, m: m}, name, args)
 }
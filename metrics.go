@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Metrics are aggregated over all guilds on purpose, labelling by guild ID
+// would make the cardinality grow with the number of servers.
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	activeStreams = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "radio_bot_active_streams",
+		Help: "Number of streams currently playing.",
+	})
+	streamsStarted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "radio_bot_streams_started_total",
+		Help: "Total number of streams started.",
+	})
+	streamErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "radio_bot_stream_errors_total",
+		Help: "Total number of streams interrupted by an error.",
+	})
+	streamReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "radio_bot_stream_reconnects_total",
+		Help: "Total number of attempts to reconnect to a dropped stream.",
+	})
+	voiceReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "radio_bot_voice_reconnects_total",
+		Help: "Total number of attempts to rejoin a dropped voice connection.",
+	})
+	bufferUnderruns = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "radio_bot_buffer_underruns_total",
+		Help: "Total number of times a stream ran out of buffered audio.",
+	})
+	bytesStreamed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "radio_bot_bytes_streamed_total",
+		Help: "Total number of Opus bytes sent to Discord.",
+	})
+	searchCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "radio_bot_search_cache_hits_total",
+		Help: "Total number of searches answered from the cache.",
+	})
+	commandInvocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "radio_bot_command_invocations_total",
+		Help: "Total number of command invocations by command.",
+	}, []string{"command"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		activeStreams,
+		streamsStarted,
+		streamErrors,
+		streamReconnects,
+		voiceReconnects,
+		bufferUnderruns,
+		bytesStreamed,
+		searchCacheHits,
+		commandInvocations,
+	)
+}
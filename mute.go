@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// setMuted silences the stream or restores the volume it had before, and
+// reports whether the muted state changed. A muted stream keeps sending
+// silent audio, unlike a paused one, so it picks up again instantly.
+func (c *Connection) setMuted(muted bool) bool {
+	c.volumeMu.Lock()
+	defer c.volumeMu.Unlock()
+
+	if c.muted == muted {
+		return false
+	}
+
+	c.muted = muted
+	if muted {
+		c.preMuteVolume = c.volume
+		c.volume = 0
+	} else {
+		c.volume = c.preMuteVolume
+	}
+	return true
+}
+
+func (c *Connection) isMuted() bool {
+	c.volumeMu.RLock()
+	defer c.volumeMu.RUnlock()
+
+	return c.muted
+}
+
+// targetVolume returns the volume set by users, which is the one restored
+// on unmute while the stream is muted.
+func (c *Connection) targetVolume() float64 {
+	c.volumeMu.RLock()
+	defer c.volumeMu.RUnlock()
+
+	if c.muted {
+		return c.preMuteVolume
+	}
+	return c.volume
+}
+
+func handleMute(s *discordgo.Session, r Responder, args []string) {
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	if !conn.setMuted(true) {
+		r.ReplyError("The stream is already muted.")
+		return
+	}
+
+	r.Reply(fmt.Sprintf("Muted. Use `%sunmute` to restore the volume.", commandPrefix(r.GuildID())))
+}
+
+func handleUnmute(s *discordgo.Session, r Responder, args []string) {
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	if !conn.setMuted(false) {
+		r.ReplyError("The stream isn't muted.")
+		return
+	}
+
+	r.Reply(fmt.Sprintf("Unmuted, volume is back to %d%%.", volumePercent(conn.currentVolume())))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// natsPublisher publishes events to a NATS subject with the core NATS
+// protocol, which is plain text over TCP.
+type natsPublisher struct {
+	brokerConn
+	subject string
+	connect []byte
+	// writeMu serializes the publishes with the PONGs of the reader.
+	writeMu sync.Mutex
+}
+
+func newNATSPublisher(rawURL, subject string) (*natsPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q, expected nats://host:port", rawURL)
+	}
+
+	options := map[string]any{"verbose": false, "pedantic": false, "name": "radio-bot"}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			options["user"] = u.User.Username()
+			options["pass"] = password
+		} else {
+			options["auth_token"] = u.User.Username()
+		}
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &natsPublisher{
+		brokerConn: brokerConn{addr: brokerAddr(u.Host, "4222")},
+		subject:    subject,
+		connect:    connect,
+	}, nil
+}
+
+func (p *natsPublisher) Publish(e webhookEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	conn, err := p.get(p.handshake)
+	if err != nil {
+		return err
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(brokerTimeout))
+	_, err = fmt.Fprintf(conn, "PUB %s %d\r\n%s\r\n", p.subject, len(body), body)
+	if err != nil {
+		p.reset()
+	}
+	return err
+}
+
+// handshake reads the INFO the server greets with and logs in. The server
+// then only sends PINGs, which are answered in the background.
+func (p *natsPublisher) handshake(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected NATS greeting %q", strings.TrimSpace(line))
+	}
+
+	_, err = fmt.Fprintf(conn, "CONNECT %s\r\n", p.connect)
+	if err != nil {
+		return err
+	}
+
+	go p.read(conn, r)
+	return nil
+}
+
+// read answers PINGs from the server, which closes connections that don't,
+// and logs any errors it reports.
+func (p *natsPublisher) read(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PING":
+			p.writeMu.Lock()
+			conn.SetWriteDeadline(time.Now().Add(brokerTimeout))
+			_, err = conn.Write([]byte("PONG\r\n"))
+			p.writeMu.Unlock()
+			if err != nil {
+				return
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			log.Println("NATS error:", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"time"
+)
+
+var errInvalidOgg = errors.New("invalid Ogg stream")
+
+// isOpusContentType reports whether a stream of contentType may carry Opus.
+// Ogg without a codecs parameter may also be Vorbis, which the stream header
+// tells apart.
+func isOpusContentType(contentType string) bool {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch mediaType {
+	case "audio/opus":
+		return true
+	case "audio/ogg", "application/ogg":
+		codecs, ok := params["codecs"]
+		return !ok || strings.Contains(strings.ToLower(codecs), "opus")
+	}
+	return false
+}
+
+// oggReader splits an Ogg stream into its packets. It expects a single
+// logical stream, like ffmpeg writes, and doesn't verify page checksums.
+type oggReader struct {
+	r        *bufio.Reader
+	segments []byte
+	partial  []byte
+}
+
+func newOggReader(r *bufio.Reader) *oggReader {
+	return &oggReader{r: r}
+}
+
+// readPacket returns the next packet, joining packets that span pages. It
+// returns io.EOF when the stream ends between packets.
+func (o *oggReader) readPacket() ([]byte, error) {
+	for {
+		for len(o.segments) > 0 {
+			size := int(o.segments[0])
+			o.segments = o.segments[1:]
+
+			segment := make([]byte, size)
+			_, err := io.ReadFull(o.r, segment)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			o.partial = append(o.partial, segment...)
+
+			// A segment shorter than 255 bytes ends the packet.
+			if size < 255 {
+				packet := o.partial
+				o.partial = nil
+				return packet, nil
+			}
+		}
+
+		err := o.readPageHeader()
+		if errors.Is(err, io.EOF) && len(o.partial) == 0 {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+}
+
+// readPageHeader reads the header of the next page along with its segment
+// table.
+func (o *oggReader) readPageHeader() error {
+	header := make([]byte, 27)
+	_, err := io.ReadFull(o.r, header)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(header[:4], []byte("OggS")) || header[4] != 0 {
+		return errInvalidOgg
+	}
+
+	o.segments = make([]byte, header[26])
+	_, err = io.ReadFull(o.r, o.segments)
+	return unexpectedEOF(err)
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// parseOpusHead checks the identification header of an Ogg Opus stream and
+// returns its channel count. Only mono and stereo streams without a channel
+// mapping table can be sent to Discord as is.
+func parseOpusHead(packet []byte) (int, error) {
+	if len(packet) < 19 || !bytes.HasPrefix(packet, []byte("OpusHead")) {
+		return 0, errors.New("not an Opus stream")
+	}
+	if packet[8]>>4 != 0 {
+		return 0, fmt.Errorf("unsupported Opus version %d", packet[8])
+	}
+
+	channelCount := int(packet[9])
+	if channelCount < 1 || channelCount > 2 || packet[18] != 0 {
+		return 0, fmt.Errorf("unsupported Opus channel layout of %d channels", channelCount)
+	}
+	return channelCount, nil
+}
+
+// opusFrameDurations are the frame durations of the Opus configurations in
+// the TOC byte, in units of 2.5ms, from RFC 6716 section 3.1.
+var opusFrameDurations = [32]time.Duration{
+	// SILK only: 10, 20, 40 and 60ms.
+	4, 8, 16, 24, 4, 8, 16, 24, 4, 8, 16, 24,
+	// Hybrid: 10 and 20ms.
+	4, 8, 4, 8,
+	// CELT only: 2.5, 5, 10 and 20ms.
+	1, 2, 4, 8, 1, 2, 4, 8, 1, 2, 4, 8, 1, 2, 4, 8,
+}
+
+// opusPacketDuration returns how much audio an Opus packet holds.
+func opusPacketDuration(packet []byte) (time.Duration, error) {
+	if len(packet) == 0 {
+		return 0, errors.New("empty Opus packet")
+	}
+
+	toc := packet[0]
+	frameDuration := opusFrameDurations[toc>>3] * 2500 * time.Microsecond
+
+	var frames int
+	switch toc & 0x3 {
+	case 0:
+		frames = 1
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0, errors.New("truncated Opus packet")
+		}
+		frames = int(packet[1] & 0x3f)
+	}
+	return time.Duration(frames) * frameDuration, nil
+}
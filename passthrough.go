@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// errNoPassthrough is a stream that can't, or can no longer, be sent to
+// Discord without re-encoding.
+var errNoPassthrough = errors.New("stream can't be passed through")
+
+// canPassthrough reports whether streamURL may be played without
+// re-encoding. The Opus packets are sent as they are, so the volume and
+// normalization can't apply and must be left at their defaults.
+func canPassthrough(conn *Connection, streamURL string) bool {
+	if !settings.OpusPassthrough || !isHTTPURL(streamURL) {
+		return false
+	}
+	if conn.currentVolume() != 1 || conn.normalizeEnabled() {
+		return false
+	}
+
+	resp, err := probeClient.Get(streamURL)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+
+	return isOpusContentType(resp.Header.Get("Content-Type"))
+}
+
+// opusCopyArgs builds the ffmpeg arguments to remux the Opus audio of
+// streamURL into Ogg, leaving the packets untouched.
+func opusCopyArgs(streamURL string) []string {
+	args := ffmpegInputArgs(streamURL)
+	return append(args,
+		"-i", streamURL,
+		"-map", "0:a:0",
+		"-c:a", "copy",
+		"-f", "ogg",
+		"pipe:1",
+	)
+}
+
+// playOpusStream sends the Opus packets of streamURL to the voice connection
+// as they are, until the stream ends, fails, is skipped or stopped, like
+// playStream. It returns errNoPassthrough before sending anything if the
+// stream isn't Opus in 20ms frames, and when the volume or normalization is
+// changed, so the caller can carry on re-encoding.
+func playOpusStream(conn *Connection, streamURL string) (bool, error) {
+	vc := conn.vc
+
+	// Discard a skip requested while nothing was playing.
+	select {
+	case <-conn.skip:
+	default:
+	}
+
+	conn.logger().Println("Starting Opus passthrough...")
+	conn.setPosition(0)
+
+	source, err := newOpusSource(streamURL)
+	if err != nil {
+		return false, err
+	}
+	defer source.Close()
+
+	quit := make(chan struct{})
+	defer close(quit)
+
+	go watchStreamTitle(streamURL, quit, conn.setTitle)
+
+	// The reader checks the stream headers and then keeps a buffer of
+	// packets ahead of the sender, like the PCM reader of playStream.
+	// packets is closed after readErr is set.
+	packets := make(chan []byte, settings.AudioBufferFrames)
+	var readErr error
+	go func() {
+		defer close(packets)
+		readErr = readOpusPackets(bufio.NewReader(source), func(packet []byte) bool {
+			select {
+			case <-quit:
+				return false
+			case packets <- packet:
+				return true
+			}
+		})
+	}()
+
+	ticker := time.NewTicker(frameDuration)
+	defer ticker.Stop()
+
+	// A restart hands over to re-encoding, see the swap case below.
+	conn.decoding.Store(true)
+	defer conn.decoding.Store(false)
+
+	played := false
+	for {
+		conn.pauseMu.Lock()
+		resume := conn.resume
+		conn.pauseMu.Unlock()
+		if resume != nil {
+			select {
+			case <-conn.stop:
+				return played, errStreamStopped
+			case <-conn.skip:
+				return played, errStreamSkipped
+			case <-resume:
+			case <-ticker.C:
+				if vc.Ready && vc.OpusSend != nil {
+					select {
+					case vc.OpusSend <- silenceFrame:
+					case <-conn.stop:
+					}
+				}
+			}
+			continue
+		}
+
+		if conn.currentVolume() != 1 || conn.normalizeEnabled() {
+			return played, fmt.Errorf("%w: the volume or normalization changed", errNoPassthrough)
+		}
+
+		var packet []byte
+		ok := true
+		select {
+		case <-conn.stop:
+			return played, errStreamStopped
+		case <-conn.skip:
+			return played, errStreamSkipped
+		case next := <-conn.swap:
+			// A restart is for the PCM path, which takes over from here.
+			next.Close()
+			return played, fmt.Errorf("%w: the stream was restarted", errNoPassthrough)
+		case packet, ok = <-packets:
+		}
+		if !ok {
+			err := readErr
+			if !played && errors.Is(err, io.EOF) {
+				if exitErr := source.exitError(); exitErr != nil {
+					err = exitErr
+				}
+			}
+			return played, err
+		}
+
+		select {
+		case <-conn.stop:
+			return played, errStreamStopped
+		case <-ticker.C:
+		}
+
+		if !vc.Ready || vc.OpusSend == nil {
+			conn.logger().Println("Discord voice connection is not ready")
+			return played, errVoiceNotReady
+		}
+		select {
+		case vc.OpusSend <- packet:
+		case <-conn.stop:
+			return played, errStreamStopped
+		}
+		bytesStreamed.Add(float64(len(packet)))
+		conn.playedFrames.Add(1)
+		played = true
+	}
+}
+
+// readOpusPackets reads an Ogg Opus stream and passes its audio packets to
+// send until it returns false or the stream ends. Discord plays one packet
+// every 20ms, so a stream with other frame durations returns
+// errNoPassthrough, which can only happen before any packet was sent.
+func readOpusPackets(r *bufio.Reader, send func(packet []byte) bool) error {
+	ogg := newOggReader(r)
+
+	head, err := ogg.readPacket()
+	if err != nil {
+		return err
+	}
+	_, err = parseOpusHead(head)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errNoPassthrough, err)
+	}
+
+	checked := false
+	for {
+		packet, err := ogg.readPacket()
+		if err != nil {
+			return err
+		}
+		if isOpusHeader(packet) {
+			continue
+		}
+
+		// Encoders don't change the frame duration midway, so checking the
+		// first packet is enough.
+		if !checked {
+			d, err := opusPacketDuration(packet)
+			if err != nil || d != frameDuration {
+				return fmt.Errorf("%w: Opus frames of %s instead of %s", errNoPassthrough, d, frameDuration)
+			}
+			checked = true
+		}
+
+		if !send(packet) {
+			return nil
+		}
+	}
+}
+
+// isOpusHeader reports whether packet is a header packet rather than audio.
+// The comment header follows the identification header, and both repeat
+// when a chained stream starts its next track.
+func isOpusHeader(packet []byte) bool {
+	return len(packet) >= 8 && (string(packet[:8]) == "OpusHead" || string(packet[:8]) == "OpusTags")
+}
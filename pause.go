@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"radio-bot/server/config"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// startPauseTimeout resumes or stops the stream once it has been paused for
+// settings.MaxPauseDuration, so a forgotten pause doesn't hold on to the
+// voice channel.
+func (c *Connection) startPauseTimeout(s *discordgo.Session) {
+	if settings.MaxPauseDuration <= 0 {
+		return
+	}
+
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+
+	pausedAt := c.pausedAt
+	if c.pauseTimer != nil {
+		c.pauseTimer.Stop()
+	}
+	c.pauseTimer = time.AfterFunc(settings.MaxPauseDuration, func() {
+		c.pauseMu.Lock()
+		stale := !c.paused || !c.pausedAt.Equal(pausedAt)
+		c.pauseMu.Unlock()
+		if stale {
+			return
+		}
+
+		limit := formatUptime(settings.MaxPauseDuration)
+		if config.PauseTimeoutAction(settings.PauseTimeoutAction) == config.PauseTimeoutResume {
+			c.logger().Println("Pause timeout reached, resuming")
+			if c.setPaused(false) {
+				sendMessage(s, c.channelID, fmt.Sprintf("Paused for %s, resumed playing.", limit))
+			}
+			return
+		}
+
+		c.logger().Println("Pause timeout reached, disconnecting")
+		if stopConnection(s, c) {
+			sendMessage(s, c.channelID, fmt.Sprintf("Paused for %s, left the voice channel.", limit))
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// restrictedCommands disrupt everyone listening, so they need the guild's
+// DJ role or the Manage Server permission.
+var restrictedCommands = map[string]bool{
+	"stop":        true,
+	"move":        true,
+	"leave":       true,
+	"volume":      true,
+	"mute":        true,
+	"unmute":      true,
+	"skip":        true,
+	"seek":        true,
+	"refresh":     true,
+	"shuffle":     true,
+	"clear":       true,
+	"removeradio": true,
+	"renameradio": true,
+}
+
+// djRole returns the role name or ID allowed to run restricted commands in a
+// guild, if one was configured.
+func djRole(guildID string) string {
+	guildSettingsMutex.RLock()
+	defer guildSettingsMutex.RUnlock()
+
+	return guildSettings[guildID].DJRole
+}
+
+// canManageGuild reports whether the user has the Manage Server permission
+// in the channel the command came from.
+func canManageGuild(s *discordgo.Session, r Responder) bool {
+	perms, err := s.State.UserChannelPermissions(r.UserID(), r.ChannelID())
+	if err != nil {
+		perms, err = s.UserChannelPermissions(r.UserID(), r.ChannelID())
+		if err != nil {
+			log.Println("Error getting user permissions:", err)
+			return false
+		}
+	}
+
+	return perms&(discordgo.PermissionManageServer|discordgo.PermissionAdministrator) != 0
+}
+
+// hasRole reports whether the user has a role matching roleName by ID or,
+// ignoring case, by name.
+func hasRole(s *discordgo.Session, guildID, userID, roleName string) bool {
+	member, err := s.State.Member(guildID, userID)
+	if err != nil {
+		member, err = s.GuildMember(guildID, userID)
+		if err != nil {
+			log.Println("Error getting guild member:", err)
+			return false
+		}
+	}
+
+	for _, roleID := range member.Roles {
+		if roleID == roleName {
+			return true
+		}
+		role, err := s.State.Role(guildID, roleID)
+		if err == nil && strings.EqualFold(role.Name, roleName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canRunCommand reports whether the user may run the named command. Commands
+// outside a guild are not restricted.
+func canRunCommand(s *discordgo.Session, r Responder, name string) bool {
+	if !restrictedCommands[name] || r.GuildID() == "" {
+		return true
+	}
+
+	if role := djRole(r.GuildID()); role != "" && hasRole(s, r.GuildID(), r.UserID(), role) {
+		return true
+	}
+
+	return canManageGuild(s, r)
+}
+
+// voicePermissionError reports the voice permissions the bot lacks in a
+// channel, by their names in the Discord client.
+type voicePermissionError struct {
+	missing []string
+}
+
+func (e *voicePermissionError) Error() string {
+	return "missing " + strings.Join(e.missing, "/") + " permission in the voice channel"
+}
+
+// checkVoicePermissions returns a *voicePermissionError when the bot can't
+// connect or speak in a voice channel, so a play fails with a clear reason
+// instead of an opaque join error. When the permissions can't be looked up,
+// the join is attempted anyway.
+func checkVoicePermissions(s *discordgo.Session, channelID string) error {
+	perms, err := s.State.UserChannelPermissions(s.State.User.ID, channelID)
+	if err != nil {
+		perms, err = s.UserChannelPermissions(s.State.User.ID, channelID)
+		if err != nil {
+			log.Println("Error getting bot permissions:", err)
+			return nil
+		}
+	}
+	log.WithField("channel", channelID).Debugf("Bot permissions in voice channel: %#x", perms)
+
+	if perms&discordgo.PermissionAdministrator != 0 {
+		return nil
+	}
+
+	var missing []string
+	if perms&discordgo.PermissionVoiceConnect == 0 {
+		missing = append(missing, "Connect")
+	}
+	if perms&discordgo.PermissionVoiceSpeak == 0 {
+		missing = append(missing, "Speak")
+	}
+	if len(missing) > 0 {
+		return &voicePermissionError{missing: missing}
+	}
+	return nil
+}
+
+// replyJoinError tells the author why the bot couldn't join the voice
+// channel, naming the missing permissions when that is the reason.
+func replyJoinError(r Responder, err error) {
+	var permErr *voicePermissionError
+	if errors.As(err, &permErr) {
+		log.Println("Not joining voice channel:", err)
+		r.ReplyError(fmt.Sprintf("I don't have permission to %s in that channel.", strings.Join(permErr.missing, "/")))
+		return
+	}
+
+	log.Println("Error joining voice channel:", err)
+	r.ReplyError("Error joining voice channel.")
+}
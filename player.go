@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"layeh.com/gopus"
+)
+
+// Player is the playback of one guild as the commands control it: started
+// with play, paused, resumed and turned up or down while it runs, and ended
+// with stopPlaying. startStream returns it to playRadioStream. Connection
+// implements it, playing an AudioSource through an Encoder.
+type Player interface {
+	play(s *discordgo.Session, station RadioStation)
+	stopPlaying()
+	currentStation() RadioStation
+	currentVolume() float64
+	// targetVolume is the volume set by the users, which currentVolume
+	// fades to.
+	targetVolume() float64
+	setVolume(volume float64)
+	isMuted() bool
+	isPaused() bool
+	setPaused(paused bool) bool
+	requestSkip()
+	finished() bool
+	// setControlMessage makes messageID the message whose reactions
+	// control the playback.
+	setControlMessage(messageID string)
+}
+
+var _ Player = (*Connection)(nil)
+
+// AudioSource decodes a stream into frames of interleaved 16-bit PCM at
+// frameRate with the given number of channels. ffmpegSource is the one used
+// in production.
+type AudioSource interface {
+	// sourceURL returns the URL the source decodes.
+	sourceURL() string
+	// readFrame reads the next frame into pcm, see readPCMFrame.
+	readFrame(pcm []int16) error
+	// prebuffer blocks until the given number of frames can be read.
+	prebuffer(frames int) error
+	// exitError closes the source and explains why it ended on its own, or
+	// returns nil if there is nothing to add to the read error.
+	exitError() error
+	Close()
+}
+
+// OpusSource remuxes a stream into Ogg Opus without decoding it, for the
+// passthrough. ffmpegSource is the one used in production.
+type OpusSource interface {
+	io.Reader
+	// exitError is like the one of AudioSource.
+	exitError() error
+	Close()
+}
+
+// Encoder compresses PCM frames into Opus packets. *gopus.Encoder
+// implements it.
+type Encoder interface {
+	Encode(pcm []int16, frameSize, maxBytes int) ([]byte, error)
+	SetBitrate(bitrate int)
+}
+
+// newAudioSource, newOpusSource and newEncoder create what a stream plays
+// through. They are variables so playback can run without ffmpeg and libopus.
+var (
+	newAudioSource = func(streamURL string, normalize bool, start time.Duration) (AudioSource, error) {
+		src, err := startFFmpeg(streamURL, normalize, start)
+		if err != nil {
+			return nil, err
+		}
+		return src, nil
+	}
+
+	newOpusSource = func(streamURL string) (OpusSource, error) {
+		src, err := runFFmpeg(streamURL, opusCopyArgs(streamURL))
+		if err != nil {
+			return nil, err
+		}
+		return src, nil
+	}
+
+	newEncoder = func(bitrate int) (Encoder, error) {
+		encoder, err := gopus.NewEncoder(frameRate, channels, gopus.Application(settings.AudioApplication))
+		if err != nil {
+			return nil, err
+		}
+		encoder.SetBitrate(bitrate)
+		return encoder, nil
+	}
+)
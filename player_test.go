@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeSource is an endless AudioSource whose frames hold only sample, so the
+// packets a test receives tell which source they came from.
+type fakeSource struct {
+	url    string
+	sample int16
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func (src *fakeSource) sourceURL() string { return src.url }
+
+func (src *fakeSource) readFrame(pcm []int16) error {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	if src.closed {
+		return io.EOF
+	}
+	for i := range pcm {
+		pcm[i] = src.sample
+	}
+	return nil
+}
+
+func (src *fakeSource) prebuffer(frames int) error { return nil }
+func (src *fakeSource) exitError() error           { return nil }
+
+func (src *fakeSource) Close() {
+	src.mu.Lock()
+	src.closed = true
+	src.mu.Unlock()
+}
+
+func (src *fakeSource) isClosed() bool {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	return src.closed
+}
+
+// fakeEncoder "encodes" a frame into its first sample, which can't be
+// mistaken for silenceFrame.
+type fakeEncoder struct {
+	mu      sync.Mutex
+	bitrate int
+}
+
+func (e *fakeEncoder) Encode(pcm []int16, frameSize, maxBytes int) ([]byte, error) {
+	return []byte{byte(pcm[0])}, nil
+}
+
+func (e *fakeEncoder) SetBitrate(bitrate int) {
+	e.mu.Lock()
+	e.bitrate = bitrate
+	e.mu.Unlock()
+}
+
+// stubAudioSources makes newAudioSource return fake sources, the nth one
+// created playing sample n, and returns the sources created so far.
+func stubAudioSources(t *testing.T) func() []*fakeSource {
+	t.Helper()
+
+	var mu sync.Mutex
+	var sources []*fakeSource
+	previous := newAudioSource
+	newAudioSource = func(streamURL string, normalize bool, start time.Duration) (AudioSource, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		src := &fakeSource{url: streamURL, sample: int16(len(sources) + 1)}
+		sources = append(sources, src)
+		return src, nil
+	}
+	t.Cleanup(func() { newAudioSource = previous })
+
+	return func() []*fakeSource {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]*fakeSource(nil), sources...)
+	}
+}
+
+// setBufferFrames sets settings.AudioBufferFrames to n for the test.
+func setBufferFrames(t *testing.T, n int) {
+	t.Helper()
+
+	previous := settings.AudioBufferFrames
+	settings.AudioBufferFrames = n
+	t.Cleanup(func() { settings.AudioBufferFrames = previous })
+}
+
+func newTestConnection() *Connection {
+	return &Connection{
+		id: "test",
+		vc: &discordgo.VoiceConnection{
+			GuildID:  "guild",
+			Ready:    true,
+			OpusSend: make(chan []byte),
+		},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		skip:      make(chan struct{}, 1),
+		swap:      make(chan AudioSource),
+		queue:     NewQueue(),
+		streaming: true,
+		volume:    1,
+	}
+}
+
+type playResult struct {
+	played bool
+	err    error
+}
+
+// startTestStream runs playStream on conn in the background.
+func startTestStream(conn *Connection, encoder Encoder, streamURL string) <-chan playResult {
+	result := make(chan playResult, 1)
+	go func() {
+		played, _, err := playStream(conn, encoder, streamURL, nil)
+		result <- playResult{played, err}
+	}()
+	return result
+}
+
+func nextPacket(t *testing.T, conn *Connection) []byte {
+	t.Helper()
+
+	select {
+	case packet := <-conn.vc.OpusSend:
+		return packet
+	case <-time.After(2 * time.Second):
+		t.Fatal("no packet was sent")
+		return nil
+	}
+}
+
+// waitForPacket reads packets until one equals want, allowing for the few
+// already on their way when the state changed.
+func waitForPacket(t *testing.T, conn *Connection, want []byte) {
+	t.Helper()
+
+	for range settings.AudioBufferFrames + 3 {
+		if bytes.Equal(nextPacket(t, conn), want) {
+			return
+		}
+	}
+	t.Fatalf("never received packet %v", want)
+}
+
+func TestPlayPauseResumeStop(t *testing.T) {
+	setBufferFrames(t, 4)
+	sources := stubAudioSources(t)
+	conn := newTestConnection()
+
+	result := startTestStream(conn, &fakeEncoder{}, "fake://stream")
+
+	if got := nextPacket(t, conn); !bytes.Equal(got, []byte{1}) {
+		t.Fatalf("first packet = %v, want the audio of the source", got)
+	}
+
+	if !conn.setPaused(true) {
+		t.Fatal("setPaused(true) didn't pause")
+	}
+	waitForPacket(t, conn, silenceFrame)
+	for range 3 {
+		if got := nextPacket(t, conn); !bytes.Equal(got, silenceFrame) {
+			t.Fatalf("packet while paused = %v, want silence", got)
+		}
+	}
+
+	if !conn.setPaused(false) {
+		t.Fatal("setPaused(false) didn't resume")
+	}
+	waitForPacket(t, conn, []byte{1})
+
+	close(conn.stop)
+	select {
+	case r := <-result:
+		if !errors.Is(r.err, errStreamStopped) || !r.played {
+			t.Errorf("playStream = %v, %v, want true, %v", r.played, r.err, errStreamStopped)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("playStream didn't return after stop")
+	}
+
+	if got := sources(); len(got) != 1 || !got[0].isClosed() {
+		t.Errorf("the source wasn't closed after stop")
+	}
+}
+
+func TestPlaySkip(t *testing.T) {
+	setBufferFrames(t, 4)
+	stubAudioSources(t)
+	conn := newTestConnection()
+
+	result := startTestStream(conn, &fakeEncoder{}, "fake://stream")
+	nextPacket(t, conn)
+
+	conn.requestSkip()
+	r := <-result
+	if !errors.Is(r.err, errStreamSkipped) {
+		t.Errorf("playStream after skip = %v, want %v", r.err, errStreamSkipped)
+	}
+}
+
+func TestPlaySourceEnds(t *testing.T) {
+	setBufferFrames(t, 4)
+	sources := stubAudioSources(t)
+	conn := newTestConnection()
+
+	result := startTestStream(conn, &fakeEncoder{}, "fake://stream")
+	nextPacket(t, conn)
+
+	sources()[0].Close()
+	var r playResult
+	for ended := false; !ended; {
+		select {
+		case r = <-result:
+			ended = true
+		case <-conn.vc.OpusSend:
+		}
+	}
+	if !errors.Is(r.err, io.EOF) {
+		t.Errorf("playStream after the source ended = %v, want %v", r.err, io.EOF)
+	}
+}
+
+func TestPlayVoiceNotReady(t *testing.T) {
+	setBufferFrames(t, 4)
+	stubAudioSources(t)
+	conn := newTestConnection()
+	conn.vc.Ready = false
+
+	r := <-startTestStream(conn, &fakeEncoder{}, "fake://stream")
+	if !errors.Is(r.err, errVoiceNotReady) || r.played {
+		t.Errorf("playStream = %v, %v, want false, %v", r.played, r.err, errVoiceNotReady)
+	}
+}
+
+func TestRestartStreamSwapsSource(t *testing.T) {
+	setBufferFrames(t, 4)
+	sources := stubAudioSources(t)
+	conn := newTestConnection()
+
+	result := startTestStream(conn, &fakeEncoder{}, "fake://stream")
+	nextPacket(t, conn)
+
+	restarted := make(chan error, 1)
+	go func() { restarted <- restartStream(conn, "fake://stream", 0) }()
+
+	// The sender keeps playing until the reader takes the new source.
+	done := false
+	for !done {
+		select {
+		case err := <-restarted:
+			if err != nil {
+				t.Fatalf("restartStream = %v", err)
+			}
+			done = true
+		case <-conn.vc.OpusSend:
+		case <-time.After(2 * time.Second):
+			t.Fatal("restartStream didn't return")
+		}
+	}
+
+	// Frames buffered from the old source are dropped on the swap, so at
+	// most the one the sender holds plays after it.
+	nextPacket(t, conn)
+	if got := nextPacket(t, conn); !bytes.Equal(got, []byte{2}) {
+		t.Errorf("packet after restart = %v, want the audio of the new source", got)
+	}
+	if !sources()[0].isClosed() {
+		t.Error("the replaced source wasn't closed")
+	}
+
+	close(conn.stop)
+	<-result
+}
+
+func TestRestartStreamNotDecoding(t *testing.T) {
+	sources := stubAudioSources(t)
+	conn := newTestConnection()
+
+	start := time.Now()
+	err := restartStream(conn, "fake://stream", 0)
+	if !errors.Is(err, errNotDecoding) {
+		t.Errorf("restartStream without a stream = %v, want %v", err, errNotDecoding)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("restartStream without a stream waited instead of failing right away")
+	}
+	if len(sources()) != 0 {
+		t.Error("restartStream without a stream started a source")
+	}
+}
+
+func TestPlayAppliesBitrateChange(t *testing.T) {
+	setBufferFrames(t, 4)
+	stubAudioSources(t)
+	conn := newTestConnection()
+	conn.bitrate.Store(64000)
+	encoder := &fakeEncoder{bitrate: 64000}
+
+	result := startTestStream(conn, encoder, "fake://stream")
+	nextPacket(t, conn)
+
+	conn.bitrate.Store(96000)
+	nextPacket(t, conn)
+	nextPacket(t, conn)
+
+	encoder.mu.Lock()
+	got := encoder.bitrate
+	encoder.mu.Unlock()
+	if got != 96000 {
+		t.Errorf("encoder bitrate after the change = %d, want 96000", got)
+	}
+
+	close(conn.stop)
+	<-result
+}
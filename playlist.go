@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxPlaylistDepth = 3
+	maxPlaylistSize  = 64 << 10
+
+	playlistM3U = "m3u"
+	playlistPLS = "pls"
+)
+
+// playlistContentTypes maps the content types of playlist files to their
+// format. HLS playlists are left out since ffmpeg plays them directly.
+var playlistContentTypes = map[string]string{
+	"audio/x-mpegurl":       playlistM3U,
+	"audio/mpegurl":         playlistM3U,
+	"application/x-mpegurl": playlistM3U,
+	"audio/x-scpls":         playlistPLS,
+	"application/x-scpls":   playlistPLS,
+	"application/pls+xml":   playlistPLS,
+}
+
+// playlistFormat returns the playlist format of a response, by content type
+// or by the extension of its URL, or an empty string if it isn't a playlist.
+func playlistFormat(u *url.URL, mediaType string) string {
+	if format, ok := playlistContentTypes[mediaType]; ok {
+		return format
+	}
+
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".m3u":
+		return playlistM3U
+	case ".pls":
+		return playlistPLS
+	}
+	return ""
+}
+
+// resolveStreamURL follows M3U and PLS playlists to the audio stream they
+// point to, trying each entry until one answers. Other URLs, including HLS
+// playlists, are returned unchanged.
+func resolveStreamURL(streamURL string) (string, error) {
+	return resolvePlaylist(streamURL, 0)
+}
+
+func resolvePlaylist(streamURL string, depth int) (string, error) {
+	resp, err := probeClient.Get(streamURL)
+	if err != nil {
+		// Leave unreachable URLs to ffmpeg, which reports the error.
+		return streamURL, nil
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	format := playlistFormat(resp.Request.URL, mediaType)
+	if format == "" || resp.StatusCode >= 400 {
+		return streamURL, nil
+	}
+
+	if depth >= maxPlaylistDepth {
+		return "", errors.New("playlists are nested too deeply")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistSize))
+	if err != nil {
+		return "", fmt.Errorf("error reading playlist: %w", err)
+	}
+
+	var entries []string
+	switch format {
+	case playlistM3U:
+		if isHLSPlaylist(data) {
+			return streamURL, nil
+		}
+		entries = parseM3U(data)
+	case playlistPLS:
+		entries = parsePLS(data)
+	}
+
+	for _, entry := range entries {
+		u, err := resp.Request.URL.Parse(entry)
+		if err != nil {
+			continue
+		}
+
+		resolved, err := resolvePlaylist(u.String(), depth+1)
+		if err != nil {
+			continue
+		}
+		if probeStream(resolved) != nil {
+			continue
+		}
+		return resolved, nil
+	}
+
+	return "", errors.New("the playlist has no playable entries")
+}
+
+// isHLSPlaylist reports whether an M3U playlist is an HLS media playlist.
+func isHLSPlaylist(data []byte) bool {
+	return bytes.Contains(data, []byte("#EXT-X-"))
+}
+
+// parseM3U returns the entries of an M3U playlist in order.
+func parseM3U(data []byte) []string {
+	var entries []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	return entries
+}
+
+// parsePLS returns the FileN entries of a PLS playlist ordered by N.
+func parsePLS(data []byte) []string {
+	type entry struct {
+		n   int
+		url string
+	}
+
+	var files []entry
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || len(key) <= 4 || !strings.EqualFold(key[:4], "file") {
+			continue
+		}
+		n, err := strconv.Atoi(key[4:])
+		if err != nil || value == "" {
+			continue
+		}
+		files = append(files, entry{n: n, url: strings.TrimSpace(value)})
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].n < files[j].n
+	})
+
+	entries := make([]string, len(files))
+	for i, f := range files {
+		entries[i] = f.url
+	}
+	return entries
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+const sampleM3U = `#EXTM3U
+#EXTINF:-1,Radio One
+http://stream.example.com:8000/live
+
+#EXTINF:-1,Radio One backup
+  http://backup.example.com/live.mp3
+relative/stream
+`
+
+const samplePLS = `[playlist]
+NumberOfEntries=3
+File2=http://second.example.com/stream
+Title2=Second
+File1=http://first.example.com/stream
+Title1=First
+file10=http://tenth.example.com/stream
+File3=
+Length1=-1
+Version=2
+`
+
+func TestParseM3U(t *testing.T) {
+	want := []string{
+		"http://stream.example.com:8000/live",
+		"http://backup.example.com/live.mp3",
+		"relative/stream",
+	}
+	if got := parseM3U([]byte(sampleM3U)); !slices.Equal(got, want) {
+		t.Errorf("parseM3U = %q, want %q", got, want)
+	}
+
+	if got := parseM3U([]byte("#EXTM3U\r\nhttp://a.example.com/\r\n")); !slices.Equal(got, []string{"http://a.example.com/"}) {
+		t.Errorf("parseM3U with CRLF = %q", got)
+	}
+	if got := parseM3U(nil); len(got) != 0 {
+		t.Errorf("parseM3U of an empty playlist = %q", got)
+	}
+}
+
+func TestParsePLS(t *testing.T) {
+	want := []string{
+		"http://first.example.com/stream",
+		"http://second.example.com/stream",
+		"http://tenth.example.com/stream",
+	}
+	if got := parsePLS([]byte(samplePLS)); !slices.Equal(got, want) {
+		t.Errorf("parsePLS = %q, want %q", got, want)
+	}
+}
+
+func TestIsHLSPlaylist(t *testing.T) {
+	hls := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:10\nsegment0.ts\n"
+	if !isHLSPlaylist([]byte(hls)) {
+		t.Error("isHLSPlaylist of an HLS playlist = false")
+	}
+	if isHLSPlaylist([]byte(sampleM3U)) {
+		t.Error("isHLSPlaylist of a plain M3U = true")
+	}
+}
+
+func TestPlaylistFormat(t *testing.T) {
+	tests := []struct {
+		url, mediaType, want string
+	}{
+		{"http://example.com/listen.pls", "text/plain", playlistPLS},
+		{"http://example.com/LISTEN.M3U", "", playlistM3U},
+		{"http://example.com/stream", "audio/x-scpls", playlistPLS},
+		{"http://example.com/stream", "audio/x-mpegurl", playlistM3U},
+		{"http://example.com/stream", "audio/mpeg", ""},
+		{"http://example.com/live.m3u8", "application/vnd.apple.mpegurl", ""},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := playlistFormat(u, tt.mediaType); got != tt.want {
+			t.Errorf("playlistFormat(%s, %q) = %q, want %q", tt.url, tt.mediaType, got, tt.want)
+		}
+	}
+}
+
+// playlistServer serves a nested playlist: an M3U pointing to a PLS whose
+// first entry is gone, and whose second is the stream.
+func playlistServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	settings.AllowPrivateStreams = true
+	t.Cleanup(func() { settings.AllowPrivateStreams = false })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/radio.m3u", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/x-mpegurl")
+		w.Write([]byte("#EXTM3U\nnested/radio.pls\n"))
+	})
+	mux.HandleFunc("/nested/radio.pls", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[playlist]\nFile1=/gone\nFile2=/live\n"))
+	})
+	mux.HandleFunc("/gone", http.NotFound)
+	mux.HandleFunc("/live", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+	})
+	mux.HandleFunc("/loop.m3u", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("/loop.m3u\n"))
+	})
+	mux.HandleFunc("/empty.pls", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[playlist]\nFile1=/gone\n"))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestResolveStreamURL(t *testing.T) {
+	server := playlistServer(t)
+
+	got, err := resolveStreamURL(server.URL + "/radio.m3u")
+	if err != nil || got != server.URL+"/live" {
+		t.Errorf("resolveStreamURL of a nested playlist = %q, %v, want %q", got, err, server.URL+"/live")
+	}
+
+	got, err = resolveStreamURL(server.URL + "/live")
+	if err != nil || got != server.URL+"/live" {
+		t.Errorf("resolveStreamURL of a stream = %q, %v, want it unchanged", got, err)
+	}
+
+	if _, err := resolveStreamURL(server.URL + "/loop.m3u"); err == nil {
+		t.Error("resolveStreamURL of a playlist including itself succeeded")
+	}
+	if _, err := resolveStreamURL(server.URL + "/empty.pls"); err == nil {
+		t.Error("resolveStreamURL of a playlist without playable entries succeeded")
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// updatePresence sets the bot status to the station being played. When the
+// bot is streaming in several guilds it shows the number of stations instead.
+func updatePresence(s *discordgo.Session) {
+	var names []string
+	for _, conn := range guilds.Connections() {
+		if conn.streaming {
+			names = append(names, conn.currentRadioName())
+		}
+	}
+
+	var err error
+	switch len(names) {
+	case 0:
+		err = s.UpdateGameStatus(0, "")
+	case 1:
+		err = s.UpdateListeningStatus(names[0])
+	default:
+		err = s.UpdateListeningStatus(fmt.Sprintf("%d stations", len(names)))
+	}
+	if err != nil {
+		log.Println("Error updating presence:", err)
+	}
+}
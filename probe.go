@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const probeTimeout = 3 * time.Second
+
+var probeClient = newHTTPClient(guardedTransport, probeTimeout)
+
+// streamContentTypes are the content types accepted from a stream URL besides
+// audio/*. They cover Ogg, HLS and playlist files and servers that don't
+// label their streams.
+var streamContentTypes = map[string]bool{
+	"application/ogg":               true,
+	"application/octet-stream":      true,
+	"application/vnd.apple.mpegurl": true,
+	"application/x-mpegurl":         true,
+	"application/pls+xml":           true,
+	"application/x-scpls":           true,
+	"video/mp2t":                    true,
+}
+
+// probeStream checks that streamURL can be reached and answers with
+// something that looks like audio. Only the response headers are read.
+func probeStream(streamURL string) error {
+	resp, err := probeClient.Get(streamURL)
+	if err != nil {
+		// SHOUTcast v1 servers answer with an "ICY 200 OK" status line that
+		// net/http can't parse but ffmpeg plays fine.
+		if strings.Contains(err.Error(), `"ICY"`) {
+			return nil
+		}
+		return fmt.Errorf("could not reach the stream: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("the stream answered %s", resp.Status)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("the stream sent an invalid content type %q", contentType)
+	}
+	if strings.HasPrefix(mediaType, "audio/") || streamContentTypes[mediaType] {
+		return nil
+	}
+
+	return fmt.Errorf("the URL doesn't look like an audio stream (content type %s)", mediaType)
+}
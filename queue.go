@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// Queue holds the stations lined up to play after the current one.
+type Queue struct {
+	items  []RadioStation
+	notify chan struct{}
+	mu     sync.Mutex
+	// closed is set once the stream of the queue ended, so nothing pushed
+	// afterwards is left behind unplayed.
+	closed bool
+}
+
+func NewQueue() *Queue {
+	return &Queue{notify: make(chan struct{}, 1)}
+}
+
+// Push appends a station and wakes up a stream waiting for the next item.
+// It reports false if the queue is closed.
+func (q *Queue) Push(station RadioStation) bool {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return false
+	}
+	q.items = append(q.items, station)
+	q.mu.Unlock()
+
+	q.wake()
+	return true
+}
+
+// PushFront puts a station at the head of the queue, so it plays next. It
+// reports false if the queue is closed.
+func (q *Queue) PushFront(station RadioStation) bool {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return false
+	}
+	q.items = append([]RadioStation{station}, q.items...)
+	q.mu.Unlock()
+
+	q.wake()
+	return true
+}
+
+func (q *Queue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Pop removes and returns the next station, if any.
+func (q *Queue) Pop() (RadioStation, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return RadioStation{}, false
+	}
+
+	station := q.items[0]
+	q.items = q.items[1:]
+	return station, true
+}
+
+// Items returns a copy of the queued stations.
+func (q *Queue) Items() []RadioStation {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := make([]RadioStation, len(q.items))
+	copy(items, q.items)
+	return items
+}
+
+// Shuffle puts the queued stations in a random order and returns how many
+// there are.
+func (q *Queue) Shuffle() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	rand.Shuffle(len(q.items), func(i, j int) {
+		q.items[i], q.items[j] = q.items[j], q.items[i]
+	})
+	return len(q.items)
+}
+
+// Clear removes all queued stations and returns them.
+func (q *Queue) Clear() []RadioStation {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := q.items
+	q.items = nil
+	return items
+}
+
+// Close clears the queue for good once its stream ended, refusing the
+// stations pushed afterwards, and returns the stations that were left.
+func (q *Queue) Close() []RadioStation {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := q.items
+	q.items = nil
+	q.closed = true
+	return items
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestQueueClose(t *testing.T) {
+	q := NewQueue()
+	a, b := RadioStation{Name: "a"}, RadioStation{Name: "b"}
+	q.Push(a)
+	q.PushFront(b)
+
+	if got := q.Close(); !slices.Equal(got, []RadioStation{b, a}) {
+		t.Errorf("Close = %v, want the queued stations", got)
+	}
+	if q.Push(a) || q.PushFront(b) {
+		t.Error("a closed queue took a station")
+	}
+	if got := q.Items(); len(got) != 0 {
+		t.Errorf("closed queue holds %v", got)
+	}
+}
+
+func TestQueueClear(t *testing.T) {
+	q := NewQueue()
+	a := RadioStation{Name: "a"}
+	q.Push(a)
+
+	if got := q.Clear(); !slices.Equal(got, []RadioStation{a}) {
+		t.Errorf("Clear = %v, want the queued station", got)
+	}
+	if !q.Push(a) {
+		t.Error("a cleared queue refused a station")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	fallbackRadioBrowserServer = "https://de1.api.radio-browser.info"
+
+	// radioBrowserTimeout bounds a request to one mirror, so a hung mirror
+	// still leaves time to fail over. searchTimeout bounds the whole search.
+	radioBrowserTimeout = 5 * time.Second
+	searchTimeout       = 10 * time.Second
+
+	// maxRateLimitBackoff caps how long to wait after a mirror answers 429.
+	maxRateLimitBackoff = 3 * time.Second
+)
+
+var (
+	radioBrowserServers     []string
+	radioBrowserServersOnce sync.Once
+
+	radioBrowserClient = newHTTPClient(http.DefaultTransport, radioBrowserTimeout)
+
+	// rateLimitBackoff is how long to wait after a mirror answers 429
+	// without a usable Retry-After. It is a variable so tests don't wait.
+	rateLimitBackoff = time.Second
+
+	errSearchTimeout           = errors.New("radio-browser search timed out")
+	errRadioBrowserUnavailable = errors.New("radio-browser is unavailable")
+)
+
+// radioBrowserBaseURLs returns the radio-browser mirrors to try, in order.
+// The mirrors are discovered once through the DNS SRV record recommended by
+// the project, unless a server is pinned in the settings.
+func radioBrowserBaseURLs() []string {
+	if settings.RadioBrowserServer != "" {
+		return []string{strings.TrimSuffix(settings.RadioBrowserServer, "/")}
+	}
+
+	radioBrowserServersOnce.Do(func() {
+		_, addrs, err := net.LookupSRV("api", "tcp", "radio-browser.info")
+		if err != nil || len(addrs) == 0 {
+			log.Println("Error discovering radio-browser servers, using the default:", err)
+			radioBrowserServers = []string{fallbackRadioBrowserServer}
+			return
+		}
+
+		for _, addr := range addrs {
+			radioBrowserServers = append(radioBrowserServers, "https://"+strings.TrimSuffix(addr.Target, "."))
+		}
+		rand.Shuffle(len(radioBrowserServers), func(i, j int) {
+			radioBrowserServers[i], radioBrowserServers[j] = radioBrowserServers[j], radioBrowserServers[i]
+		})
+		log.Debug("Discovered radio-browser servers: ", radioBrowserServers)
+	})
+
+	return radioBrowserServers
+}
+
+// radioBrowserGet requests path from the radio-browser API, failing over to
+// the next mirror when one can't be reached or answers with a server error.
+// A mirror rate limiting the bot is retried after a backoff, once if it is
+// the last one. It gives up without trying further mirrors once ctx is done.
+// Failures of the API are wrapped in errRadioBrowserUnavailable.
+func radioBrowserGet(ctx context.Context, path string, params url.Values) (*http.Response, error) {
+	baseURLs := radioBrowserBaseURLs()
+	retried := false
+
+	var lastErr error
+	for i := 0; i < len(baseURLs); i++ {
+		baseURL := baseURLs[i]
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path+"?"+params.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := radioBrowserClient.Do(req)
+		if err != nil {
+			log.Debug("Error querying radio-browser server ", baseURL, ": ", err)
+			if ctx.Err() != nil {
+				return nil, timeoutError(err)
+			}
+			lastErr = err
+			continue
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			resp.Body.Close()
+			log.Debug("Radio-browser server ", baseURL, " is rate limiting, backing off")
+			lastErr = fmt.Errorf("radio-browser server %s answered %s", baseURL, resp.Status)
+
+			select {
+			case <-ctx.Done():
+				return nil, timeoutError(ctx.Err())
+			case <-time.After(retryAfter(resp)):
+			}
+			if i == len(baseURLs)-1 && !retried {
+				retried = true
+				i--
+			}
+			continue
+		case resp.StatusCode >= http.StatusInternalServerError:
+			resp.Body.Close()
+			log.Debug("Radio-browser server ", baseURL, " answered ", resp.Status)
+			lastErr = fmt.Errorf("radio-browser server %s answered %s", baseURL, resp.Status)
+			continue
+		case resp.StatusCode >= http.StatusBadRequest:
+			resp.Body.Close()
+			return nil, fmt.Errorf("radio-browser server %s answered %s", baseURL, resp.Status)
+		}
+
+		return resp, nil
+	}
+
+	return nil, unavailableError(lastErr)
+}
+
+// retryAfter returns how long a rate limited mirror asked to wait, within
+// maxRateLimitBackoff, or rateLimitBackoff if it didn't say.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return rateLimitBackoff
+	}
+	return min(time.Duration(seconds)*time.Second, maxRateLimitBackoff)
+}
+
+// unavailableError wraps an error of the API in errRadioBrowserUnavailable,
+// or in errSearchTimeout if it is a timeout.
+func unavailableError(err error) error {
+	if err := timeoutError(err); errors.Is(err, errSearchTimeout) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", errRadioBrowserUnavailable, err)
+}
+
+// timeoutError wraps err in errSearchTimeout if it is a timeout, so callers
+// can tell a slow API apart from other failures.
+func timeoutError(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %v", errSearchTimeout, err)
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubRadioBrowser serves each handler as a radio-browser mirror, tried in
+// the order given.
+func stubRadioBrowser(t *testing.T, handlers ...http.HandlerFunc) {
+	t.Helper()
+
+	// Keep radioBrowserBaseURLs from discovering the real mirrors.
+	radioBrowserServersOnce.Do(func() {})
+
+	previous := radioBrowserServers
+	radioBrowserServers = nil
+	for _, handler := range handlers {
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+		radioBrowserServers = append(radioBrowserServers, server.URL)
+	}
+	t.Cleanup(func() { radioBrowserServers = previous })
+}
+
+// answerStations answers a search with a single station.
+func answerStations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`[{"name":"Jazz FM","url_resolved":"http://jazz.example.com/live","votes":3,"clickcount":7}]`))
+}
+
+// hang answers once the request is cancelled, or after a minute.
+func hang(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(time.Minute):
+	}
+}
+
+func TestSearchRadioStations(t *testing.T) {
+	var agent, query string
+	stubRadioBrowser(t, func(w http.ResponseWriter, r *http.Request) {
+		agent = r.UserAgent()
+		query = r.URL.Query().Get("name")
+		answerStations(w, r)
+	})
+
+	stations, err := searchRadioStations(context.Background(), SearchQuery{Name: "jazz"})
+	if err != nil {
+		t.Fatalf("searchRadioStations = %v", err)
+	}
+	if len(stations) != 1 || stations[0].Name != "Jazz FM" || stations[0].URL != "http://jazz.example.com/live" {
+		t.Errorf("searchRadioStations = %+v, want Jazz FM", stations)
+	}
+	if query != "jazz" {
+		t.Errorf("searched for %q, want %q", query, "jazz")
+	}
+	if !strings.HasPrefix(agent, "radio-bot/") {
+		t.Errorf("User-Agent = %q, want the bot's", agent)
+	}
+}
+
+func TestSearchRadioStationsTimeout(t *testing.T) {
+	stubRadioBrowser(t, hang)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := searchRadioStations(ctx, SearchQuery{Name: "jazz"})
+	if !errors.Is(err, errSearchTimeout) {
+		t.Errorf("searchRadioStations of a hung server = %v, want %v", err, errSearchTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("searchRadioStations took %s after its deadline", elapsed)
+	}
+}
+
+func TestSearchRadioStationsMirrorTimeout(t *testing.T) {
+	previous := radioBrowserClient
+	radioBrowserClient = newHTTPClient(http.DefaultTransport, 50*time.Millisecond)
+	t.Cleanup(func() { radioBrowserClient = previous })
+
+	// A hung mirror is given up for the next one.
+	stubRadioBrowser(t, hang, answerStations)
+	stations, err := searchRadioStations(context.Background(), SearchQuery{Name: "jazz"})
+	if err != nil || len(stations) != 1 {
+		t.Errorf("searchRadioStations after a hung mirror = %v, %v, want the station of the next one", stations, err)
+	}
+
+	stubRadioBrowser(t, hang, hang)
+	_, err = searchRadioStations(context.Background(), SearchQuery{Name: "jazz"})
+	if !errors.Is(err, errSearchTimeout) {
+		t.Errorf("searchRadioStations with every mirror hung = %v, want %v", err, errSearchTimeout)
+	}
+}
+
+// answerStatus answers every request with code.
+func answerStatus(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(code), code)
+	}
+}
+
+func TestSearchRadioStationsErrorStatus(t *testing.T) {
+	previous := rateLimitBackoff
+	rateLimitBackoff = time.Millisecond
+	t.Cleanup(func() { rateLimitBackoff = previous })
+
+	// rateLimitedOnce answers 429 to the first request only.
+	rateLimitedOnce := func() http.HandlerFunc {
+		limited := false
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !limited {
+				limited = true
+				answerStatus(http.StatusTooManyRequests)(w, r)
+				return
+			}
+			answerStations(w, r)
+		}
+	}
+	htmlPage := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body>502 Bad Gateway</body></html>"))
+	}
+
+	tests := []struct {
+		name    string
+		mirrors []http.HandlerFunc
+		wantErr error
+	}{
+		{"rate limited, then the next mirror", []http.HandlerFunc{answerStatus(http.StatusTooManyRequests), answerStations}, nil},
+		{"rate limited, then retried", []http.HandlerFunc{rateLimitedOnce()}, nil},
+		{"rate limited everywhere", []http.HandlerFunc{answerStatus(http.StatusTooManyRequests), answerStatus(http.StatusTooManyRequests)}, errRadioBrowserUnavailable},
+		{"server error, then the next mirror", []http.HandlerFunc{answerStatus(http.StatusInternalServerError), answerStations}, nil},
+		{"server error everywhere", []http.HandlerFunc{answerStatus(http.StatusInternalServerError), answerStatus(http.StatusServiceUnavailable)}, errRadioBrowserUnavailable},
+		{"not JSON", []http.HandlerFunc{htmlPage}, errRadioBrowserUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubRadioBrowser(t, tt.mirrors...)
+
+			stations, err := searchRadioStations(context.Background(), SearchQuery{Name: "jazz"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("searchRadioStations = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && len(stations) != 1 {
+				t.Errorf("searchRadioStations = %+v, want the station", stations)
+			}
+		})
+	}
+}
+
+func TestSearchRadioStationsClientError(t *testing.T) {
+	calls := 0
+	stubRadioBrowser(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		answerStatus(http.StatusBadRequest)(w, r)
+	}, answerStations)
+
+	// A bad request would be as bad on every mirror, so it isn't retried or
+	// reported as an outage.
+	_, err := searchRadioStations(context.Background(), SearchQuery{Name: "jazz"})
+	if err == nil || errors.Is(err, errRadioBrowserUnavailable) {
+		t.Errorf("searchRadioStations answered 400 = %v, want an error other than %v", err, errRadioBrowserUnavailable)
+	}
+	if calls != 1 {
+		t.Errorf("the mirror was asked %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultCategory groups the built-in stations, and customCategory the
+// custom ones added without a category.
+const (
+	defaultCategory = "Default"
+	customCategory  = "Custom"
+)
+
+// CustomRadio is a station added with !addradio.
+type CustomRadio struct {
+	URL      string `json:"url"`
+	Category string `json:"category,omitempty"`
+}
+
+// lookupRadio resolves a radio name to its stream URL, checking the built-in
+// stations before the custom ones.
+func lookupRadio(radioName string) (string, bool) {
+	radioName = normalizeRadioName(radioName)
+	if streamURL, ok := builtinRadio(radioName); ok {
+		return streamURL, true
+	}
+
+	radio, ok, err := store.CustomRadio(radioName)
+	if err != nil {
+		log.Println("Error looking up custom radio:", err)
+		return "", false
+	}
+	return radio.URL, ok
+}
+
+// customRadios returns the custom radios by name.
+func customRadios() map[string]CustomRadio {
+	radios, err := store.ListCustomRadios()
+	if err != nil {
+		log.Println("Error listing custom radios:", err)
+	}
+	return radios
+}
+
+// radiosByCategory groups the names of all radios by category, each sorted.
+func radiosByCategory() map[string][]string {
+	categories := make(map[string][]string)
+	for name := range builtinRadios() {
+		categories[defaultCategory] = append(categories[defaultCategory], name)
+	}
+	for name, radio := range customRadios() {
+		category := radio.Category
+		if category == "" {
+			category = customCategory
+		}
+		categories[category] = append(categories[category], name)
+	}
+
+	for _, names := range categories {
+		slices.Sort(names)
+	}
+	return categories
+}
+
+// maxRadioMatches caps how many candidates a fuzzy lookup offers.
+const maxRadioMatches = 10
+
+// matchRadios returns the names of the radios that radioName could mean.
+// An exact match is the only result. Otherwise it returns the names that
+// contain radioName or are contained in it, followed by the names within a
+// few typos of it, closest first.
+func matchRadios(radioName string) []string {
+	radioName = normalizeRadioName(radioName)
+	if _, ok := lookupRadio(radioName); ok {
+		return []string{radioName}
+	}
+
+	names := slices.Collect(maps.Keys(builtinRadios()))
+	for name := range customRadios() {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	// Allow about one typo every four characters.
+	maxDistance := max(1, utf8.RuneCountInString(radioName)/4)
+
+	var matches []string
+	scores := make(map[string]int)
+	for _, name := range names {
+		if strings.Contains(name, radioName) || strings.Contains(radioName, name) {
+			matches = append(matches, name)
+			scores[name] = 0
+		} else if d := levenshtein(radioName, name); d <= maxDistance {
+			matches = append(matches, name)
+			scores[name] = d
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b string) int {
+		return scores[a] - scores[b]
+	})
+	return matches[:min(len(matches), maxRadioMatches)]
+}
+
+// levenshtein returns the number of single character insertions, deletions
+// and substitutions needed to turn a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+func isValidURL(u string) bool {
+	_, err := url.ParseRequestURI(u)
+	return err == nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket per key. Each key may run burst commands at
+// once and regains one every interval.
+type rateLimiter struct {
+	interval time.Duration
+	burst    float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newRateLimiter(interval time.Duration, burst int) *rateLimiter {
+	return &rateLimiter{
+		interval: interval,
+		burst:    float64(max(burst, 1)),
+		buckets:  make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from the bucket of key and reports whether one was
+// available. A limiter without an interval allows everything.
+func (l *rateLimiter) allow(key string) bool {
+	if l.interval <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = l.refill(b, now)
+	b.updated = now
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+func (l *rateLimiter) refill(b *tokenBucket, now time.Time) float64 {
+	return min(l.burst, b.tokens+float64(now.Sub(b.updated))/float64(l.interval))
+}
+
+// prune drops the buckets that have refilled completely, since they behave
+// the same as a missing one. It runs at most once a minute.
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// commandLimiter throttles commands per user. It is set up in main once the
+// settings are loaded.
+var commandLimiter = newRateLimiter(0, 1)
+
+// allowCommand reports whether userID may run another command right now.
+// Admin users are never throttled.
+func allowCommand(userID string) bool {
+	if slices.Contains(settings.AdminUserIDs, userID) {
+		return true
+	}
+	return commandLimiter.allow(userID)
+}
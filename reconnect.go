@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// noteReconnect counts a reconnect to the current station and tells the
+// channel about the trouble once settings.ReconnectNotifyAfter consecutive
+// reconnects failed to bring the stream back for good. Brief drops that
+// recover on the first attempts stay out of the chat.
+func (c *Connection) noteReconnect(s *discordgo.Session, station RadioStation) {
+	failures := int(c.reconnectFailures.Add(1))
+	if settings.ReconnectNotifyAfter <= 0 || failures < settings.ReconnectNotifyAfter {
+		return
+	}
+	if c.troubleNotified.CompareAndSwap(false, true) {
+		sendMessage(s, c.channelID, fmt.Sprintf("Having trouble with the stream for %s, still trying to reconnect.", station.Name))
+	}
+}
+
+// watchRecovery resets the reconnect count once the stream has played for
+// settings.ReconnectRecoveredAfter, telling the channel it's back if it was
+// told about the trouble. The returned function cancels the watch when the
+// stream ends before that.
+func (c *Connection) watchRecovery(s *discordgo.Session, station RadioStation) func() {
+	if c.reconnectFailures.Load() == 0 {
+		return func() {}
+	}
+
+	timer := time.AfterFunc(settings.ReconnectRecoveredAfter, func() {
+		if c.playedFrames.Load() == 0 {
+			return
+		}
+		c.reconnectFailures.Store(0)
+		if c.troubleNotified.CompareAndSwap(true, false) {
+			sendMessage(s, c.channelID, fmt.Sprintf("The stream for %s is back.", station.Name))
+		}
+	})
+	return func() { timer.Stop() }
+}
+
+// resetReconnects forgets the reconnects of the previous station.
+func (c *Connection) resetReconnects() {
+	c.reconnectFailures.Store(0)
+	c.troubleNotified.Store(false)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// redisPublisher publishes events to a Redis pub/sub channel with the RESP
+// protocol.
+type redisPublisher struct {
+	brokerConn
+	channel string
+	auth    []string
+	reader  *bufio.Reader
+}
+
+func newRedisPublisher(rawURL, channel string) (*redisPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("invalid Redis URL %q, expected redis://host:port", rawURL)
+	}
+
+	// Pub/sub channels are shared by all databases, so the path is ignored.
+	var auth []string
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			auth = []string{"AUTH", password}
+			if u.User.Username() != "" {
+				auth = []string{"AUTH", u.User.Username(), password}
+			}
+		}
+	}
+
+	return &redisPublisher{
+		brokerConn: brokerConn{addr: brokerAddr(u.Host, "6379")},
+		channel:    channel,
+		auth:       auth,
+	}, nil
+}
+
+func (p *redisPublisher) Publish(e webhookEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	conn, err := p.get(p.handshake)
+	if err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Now().Add(brokerTimeout))
+	err = p.command(conn, "PUBLISH", p.channel, string(body))
+	if err != nil {
+		p.reset()
+	}
+	return err
+}
+
+func (p *redisPublisher) handshake(conn net.Conn) error {
+	p.reader = bufio.NewReader(conn)
+	if p.auth == nil {
+		return nil
+	}
+	return p.command(conn, p.auth...)
+}
+
+// command sends a command and reads its reply, returning the errors Redis
+// answers with.
+func (p *redisPublisher) command(conn net.Conn, args ...string) error {
+	_, err := conn.Write(respCommand(args))
+	if err != nil {
+		return err
+	}
+
+	line, err := p.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(line, "-") {
+		return fmt.Errorf("redis: %s", strings.TrimSpace(line[1:]))
+	}
+	return nil
+}
+
+// respCommand encodes a command as a RESP array of bulk strings.
+func respCommand(args []string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"radio-bot/server/config"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/joho/godotenv"
+	log "github.com/sirupsen/logrus"
+)
+
+// reloadMu guards the settings reloadSettings changes, which commands and
+// streams read while it runs. The other settings are only set at startup.
+var reloadMu sync.RWMutex
+
+// defaultPrefix returns the COMMAND_PREFIX setting.
+func defaultPrefix() string {
+	reloadMu.RLock()
+	defer reloadMu.RUnlock()
+
+	return settings.CommandPrefix
+}
+
+// stationsFile returns the STATIONS_FILE setting.
+func stationsFile() string {
+	reloadMu.RLock()
+	defer reloadMu.RUnlock()
+
+	return settings.StationsFile
+}
+
+// reloadSettings re-reads the .env file and the environment, where the
+// environment wins like at startup, and applies the
+// settings that are safe to change while streams are running: the log level,
+// the default command prefix and the stations file. It also re-reads the
+// custom radios. It returns a description of each thing reloaded.
+func reloadSettings() ([]string, error) {
+	err := godotenv.Load()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading .env: %w", err)
+	}
+
+	next, err := config.LoadSettings()
+	if err != nil {
+		return nil, fmt.Errorf("error loading settings: %w", err)
+	}
+
+	var reloaded []string
+
+	reloadMu.Lock()
+	settings.LogLevel = next.LogLevel
+	settings.CommandPrefix = next.CommandPrefix
+	settings.StationsFile = next.StationsFile
+	reloadMu.Unlock()
+
+	log.SetLevel(log.Level(next.LogLevel))
+	reloaded = append(reloaded, "log level "+log.Level(next.LogLevel).String())
+	reloaded = append(reloaded, fmt.Sprintf("default prefix `%s`", next.CommandPrefix))
+
+	n, err := loadStations()
+	if err != nil {
+		log.Println("Error reloading stations:", err)
+		reloaded = append(reloaded, fmt.Sprintf("stations kept, %s has an error: %v", next.StationsFile, err))
+	} else {
+		reloaded = append(reloaded, fmt.Sprintf("%d built-in stations", n))
+	}
+
+	err = store.Reload()
+	if err != nil {
+		log.Println("Error reloading custom radios:", err)
+		reloaded = append(reloaded, fmt.Sprintf("custom radios kept: %v", err))
+	} else {
+		reloaded = append(reloaded, fmt.Sprintf("%d custom radios", len(customRadios())))
+	}
+
+	return reloaded, nil
+}
+
+func handleReload(s *discordgo.Session, r Responder, args []string) {
+	if !isBotAdmin(r) {
+		r.ReplyError("Only the bot owner and admins can reload the settings, since they apply to every server.")
+		return
+	}
+
+	log.WithFields(log.Fields{"user": r.UserID(), "guild": r.GuildID()}).Warn("Reloading settings")
+
+	reloaded, err := reloadSettings()
+	if err != nil {
+		log.Println("Error reloading settings:", err)
+		r.ReplyError(fmt.Sprintf("Could not reload, nothing was changed: %v.", err))
+		return
+	}
+
+	r.Reply("Reloaded:\n- " + strings.Join(reloaded, "\n- "))
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// Responder abstracts where a command came from, so the same handlers can
+// serve both text commands and slash commands.
+type Responder interface {
+	GuildID() string
+	UserID() string
+	ChannelID() string
+	Reply(text string)
+	ReplyError(text string)
+	// ReplyEmbed sends an embed and returns the ID of the message it was
+	// sent in, or an empty string if it could not be sent.
+	ReplyEmbed(embed *discordgo.MessageEmbed) string
+}
+
+// messageResponder answers a text command in the channel it was sent to.
+// Replies are attached to the command message, while embeds such as the
+// now-playing announcement stand on their own.
+type messageResponder struct {
+	s *discordgo.Session
+	m *discordgo.MessageCreate
+}
+
+func (r *messageResponder) GuildID() string   { return r.m.GuildID }
+func (r *messageResponder) UserID() string    { return r.m.Author.ID }
+func (r *messageResponder) ChannelID() string { return r.m.ChannelID }
+
+func (r *messageResponder) Reply(text string) {
+	reply(r.s, r.m, text)
+}
+
+func (r *messageResponder) ReplyError(text string) {
+	reply(r.s, r.m, text)
+}
+
+func (r *messageResponder) ReplyEmbed(embed *discordgo.MessageEmbed) string {
+	msg, err := r.s.ChannelMessageSendEmbed(r.m.ChannelID, embed)
+	if err != nil {
+		log.WithField("channel", r.m.ChannelID).Println("Error sending embed:", err)
+		return ""
+	}
+	return msg.ID
+}
+
+// interactionResponder answers a slash command. The first reply responds to
+// the interaction and any further replies are sent as followup messages.
+type interactionResponder struct {
+	s         *discordgo.Session
+	i         *discordgo.InteractionCreate
+	responded bool
+	// deferred is set while the interaction shows the loading message of
+	// deferReply, which the first reply takes the place of.
+	deferred bool
+}
+
+func (r *interactionResponder) GuildID() string   { return r.i.GuildID }
+func (r *interactionResponder) ChannelID() string { return r.i.ChannelID }
+
+func (r *interactionResponder) UserID() string {
+	if r.i.Member != nil {
+		return r.i.Member.User.ID
+	}
+	return r.i.User.ID
+}
+
+func (r *interactionResponder) Reply(text string) {
+	r.send(text, nil, 0)
+}
+
+func (r *interactionResponder) ReplyError(text string) {
+	r.send(text, nil, discordgo.MessageFlagsEphemeral)
+}
+
+func (r *interactionResponder) ReplyEmbed(embed *discordgo.MessageEmbed) string {
+	return r.send("", []*discordgo.MessageEmbed{embed}, 0)
+}
+
+// deferReply acknowledges the interaction before a slow command runs, so
+// Discord shows the bot as thinking instead of failing the interaction.
+func (r *interactionResponder) deferReply() {
+	err := r.s.InteractionRespond(r.i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Println("Error deferring interaction response:", err)
+		return
+	}
+	r.responded = true
+	r.deferred = true
+}
+
+// send replies to the interaction and returns the ID of the reply.
+func (r *interactionResponder) send(text string, embeds []*discordgo.MessageEmbed, flags discordgo.MessageFlags) string {
+	if r.deferred {
+		r.deferred = false
+		if flags&discordgo.MessageFlagsEphemeral == 0 {
+			edit := &discordgo.WebhookEdit{Content: &text, AllowedMentions: replyMentions()}
+			if len(embeds) > 0 {
+				edit.Embeds = &embeds
+			}
+			msg, err := r.s.InteractionResponseEdit(r.i.Interaction, edit)
+			if err != nil {
+				log.Println("Error editing interaction response:", err)
+				return ""
+			}
+			return msg.ID
+		}
+
+		// The loading message is public, so an ephemeral reply can't take
+		// its place and is sent as a followup instead.
+		err := r.s.InteractionResponseDelete(r.i.Interaction)
+		if err != nil {
+			log.Println("Error deleting interaction response:", err)
+		}
+	}
+
+	if r.responded {
+		msg, err := r.s.FollowupMessageCreate(r.i.Interaction, true, &discordgo.WebhookParams{
+			Content:         text,
+			Embeds:          embeds,
+			Flags:           flags,
+			AllowedMentions: replyMentions(),
+		})
+		if err != nil {
+			log.Println("Error sending followup message:", err)
+			return ""
+		}
+		return msg.ID
+	}
+
+	r.responded = true
+	err := r.s.InteractionRespond(r.i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:         text,
+			Embeds:          embeds,
+			Flags:           flags,
+			AllowedMentions: replyMentions(),
+		},
+	})
+	if err != nil {
+		log.Println("Error responding to interaction:", err)
+		return ""
+	}
+
+	msg, err := r.s.InteractionResponse(r.i.Interaction)
+	if err != nil {
+		log.Println("Error getting interaction response:", err)
+		return ""
+	}
+	return msg.ID
+}
+
+// reactionResponder runs a command triggered by a reaction on the controls
+// of the now-playing message. The reaction itself acknowledges the command,
+// so only errors are sent to the channel.
+type reactionResponder struct {
+	s *discordgo.Session
+	r *discordgo.MessageReactionAdd
+}
+
+func (r *reactionResponder) GuildID() string   { return r.r.GuildID }
+func (r *reactionResponder) UserID() string    { return r.r.UserID }
+func (r *reactionResponder) ChannelID() string { return r.r.ChannelID }
+
+func (r *reactionResponder) Reply(text string) {}
+
+func (r *reactionResponder) ReplyError(text string) {
+	sendMessage(r.s, r.r.ChannelID, text)
+}
+
+func (r *reactionResponder) ReplyEmbed(embed *discordgo.MessageEmbed) string { return "" }
+
+// sendMessage sends text to a channel, logging instead of failing when the
+// bot can't send there, e.g. when it lacks access to the channel or a thread
+// was archived. Nothing is sent without a channel.
+func sendMessage(s *discordgo.Session, channelID, text string) {
+	if channelID == "" {
+		return
+	}
+
+	sendChunked(s, channelID, text)
+}
+
+// replyMentions are the mentions replies to commands may make: users, but
+// not roles or everyone, which radio names could contain.
+func replyMentions() *discordgo.MessageAllowedMentions {
+	return &discordgo.MessageAllowedMentions{
+		Parse: []discordgo.AllowedMentionType{discordgo.AllowedMentionTypeUsers},
+	}
+}
+
+// reply answers m with a Discord reply, so it is clear which command the text
+// responds to in a busy channel. It goes to the channel of the command, which
+// is the thread itself for commands sent in threads and forum posts. The
+// author isn't pinged, radio names can't mention roles or everyone, and the
+// text is sent as a plain message if m was deleted in the meantime.
+func reply(s *discordgo.Session, m *discordgo.MessageCreate, text string) {
+	_, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content:         text,
+		Reference:       m.SoftReference(),
+		AllowedMentions: replyMentions(),
+	})
+	if err != nil {
+		log.WithField("channel", m.ChannelID).Println("Error sending reply:", err)
+	}
+}
+
+// messageLimit is the most characters Discord accepts in a message.
+const messageLimit = 2000
+
+// chunkLines joins lines into as few messages as possible, each within
+// limit characters. Longer lines are wrapped at spaces, or cut where they
+// have none.
+func chunkLines(lines []string, limit int) []string {
+	var chunks []string
+	var current strings.Builder
+	for _, line := range lines {
+		for _, part := range wrapLine(line, limit) {
+			if current.Len() > 0 && current.Len()+1+len(part) > limit {
+				chunks = append(chunks, current.String())
+				current.Reset()
+			}
+			if current.Len() > 0 {
+				current.WriteByte('\n')
+			}
+			current.WriteString(part)
+		}
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
+
+// wrapLine splits a line into parts of at most limit bytes, breaking after
+// the last space that fits and otherwise between characters.
+func wrapLine(line string, limit int) []string {
+	var parts []string
+	for len(line) > limit {
+		cut := strings.LastIndexByte(line[:limit+1], ' ')
+		if cut <= 0 {
+			// Back up to the start of a character, so none is split.
+			cut = limit
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+		}
+		parts = append(parts, strings.TrimRight(line[:cut], " "))
+		line = strings.TrimLeft(line[cut:], " ")
+	}
+	return append(parts, line)
+}
+
+// splitMessage splits text into messages within Discord's limit, keeping
+// lines together where possible.
+func splitMessage(text string) []string {
+	return chunkLines(strings.Split(text, "\n"), messageLimit)
+}
+
+// sendChunked sends text to a channel in as many messages as it takes to
+// stay within Discord's limit. It stops at the first message that can't be
+// sent, since the rest would be out of context. The text carries station and
+// user names, so it mentions nobody.
+func sendChunked(s *discordgo.Session, channelID, text string) error {
+	for _, chunk := range splitMessage(text) {
+		_, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+			Content:         chunk,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err != nil {
+			log.WithField("channel", channelID).Println("Error sending message:", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// replyChunked answers a command with text that may not fit into a single
+// message, like the lists of the list commands.
+func replyChunked(r Responder, text string) {
+	for _, chunk := range splitMessage(text) {
+		r.Reply(chunk)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestWrapLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		limit int
+		want  []string
+	}{
+		{"", 10, []string{""}},
+		{"short", 10, []string{"short"}},
+		{"exactly 10", 10, []string{"exactly 10"}},
+		{"breaks at the last space", 10, []string{"breaks at", "the last", "space"}},
+		{"abcdefghijklmno", 5, []string{"abcde", "fghij", "klmno"}},
+		{"spaces     between", 8, []string{"spaces", "between"}},
+		// Cuts back up to the start of a character.
+		{"ééééé", 5, []string{"éé", "éé", "é"}},
+		{"日本語のラジオ", 7, []string{"日本", "語の", "ラジ", "オ"}},
+	}
+	for _, tt := range tests {
+		got := wrapLine(tt.line, tt.limit)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("wrapLine(%q, %d) = %q, want %q", tt.line, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestChunkLines(t *testing.T) {
+	tests := []struct {
+		lines []string
+		limit int
+		want  []string
+	}{
+		{nil, 10, nil},
+		{[]string{"a", "b", "c"}, 10, []string{"a\nb\nc"}},
+		{[]string{"12345", "1234"}, 10, []string{"12345\n1234"}},
+		{[]string{"12345", "12345"}, 10, []string{"12345", "12345"}},
+		{[]string{"a", "breaks at the last space"}, 10, []string{"a", "breaks at", "the last", "space"}},
+	}
+	for _, tt := range tests {
+		got := chunkLines(tt.lines, tt.limit)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("chunkLines(%q, %d) = %q, want %q", tt.lines, tt.limit, got, tt.want)
+		}
+	}
+}
+
+// checkChunks checks that chunks are valid messages holding the lines of
+// text in order.
+func checkChunks(t *testing.T, text string, chunks []string) {
+	t.Helper()
+
+	for i, chunk := range chunks {
+		if len(chunk) > messageLimit {
+			t.Errorf("message %d has %d bytes, over the limit of %d", i, len(chunk), messageLimit)
+		}
+		if chunk == "" {
+			t.Errorf("message %d is empty", i)
+		}
+		if !utf8.ValidString(chunk) {
+			t.Errorf("message %d splits a character", i)
+		}
+	}
+	// Only whitespace is dropped where long lines are wrapped.
+	squash := func(s string) string { return strings.Join(strings.Fields(s), "") }
+	if squash(strings.Join(chunks, "\n")) != squash(text) {
+		t.Error("the messages don't hold the text in order")
+	}
+}
+
+func TestSplitMessageLargeStationList(t *testing.T) {
+	categories := map[string][]string{}
+	for i := range 600 {
+		category := fmt.Sprintf("Category %d", i%5)
+		categories[category] = append(categories[category], fmt.Sprintf("Rádio Estação %03d FM", i))
+	}
+	if radioListFitsEmbed(categories) {
+		t.Fatal("the synthetic station list fits an embed")
+	}
+
+	text := radioListText(categories)
+	chunks := splitMessage(text)
+	if len(chunks) < 2 {
+		t.Fatalf("a list of %d bytes was sent in %d message", len(text), len(chunks))
+	}
+	checkChunks(t, text, chunks)
+}
+
+func TestSplitMessageLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{"at the limit", strings.Repeat("a", messageLimit), 1},
+		{"one past the limit", strings.Repeat("a", messageLimit+1), 2},
+		{"lines filling the limit", strings.Repeat(strings.Repeat("a", 999)+"\n", 2)[:1999], 1},
+		{"lines one past the limit", strings.Repeat(strings.Repeat("a", 1000)+"\n", 2)[:2001], 2},
+		{"multibyte at the limit", strings.Repeat("é", messageLimit/2) + "é", 2},
+		{"huge line", strings.Repeat("word ", 2000), 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := splitMessage(tt.text)
+			if len(chunks) != tt.want {
+				t.Errorf("splitMessage gave %d messages, want %d", len(chunks), tt.want)
+			}
+			checkChunks(t, tt.text, chunks)
+		})
+	}
+}
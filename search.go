@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchFilters are the radio-browser search parameters that can be passed
+// as key:value pairs, e.g. `country:Brazil tag:jazz`.
+var searchFilters = map[string]bool{
+	"country":     true,
+	"countrycode": true,
+	"tag":         true,
+	"language":    true,
+}
+
+// SearchQuery is a station search by name with optional filters.
+type SearchQuery struct {
+	Name    string
+	Filters map[string]string
+}
+
+// parseSearchQuery splits search arguments into the station name and the
+// recognized key:value filters. Unrecognized filters are returned separately
+// so the caller can warn about them.
+func parseSearchQuery(args []string) (SearchQuery, []string) {
+	query := SearchQuery{Filters: map[string]string{}}
+	var words, unknown []string
+
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, ":")
+		if !ok || key == "" || value == "" || strings.Contains(key, "/") {
+			words = append(words, arg)
+			continue
+		}
+
+		key = strings.ToLower(key)
+		if !searchFilters[key] {
+			unknown = append(unknown, key)
+			continue
+		}
+		query.Filters[key] = value
+	}
+
+	query.Name = strings.Join(words, " ")
+	return query, unknown
+}
+
+func (q SearchQuery) isEmpty() bool {
+	return q.Name == "" && len(q.Filters) == 0
+}
+
+func searchRadioStations(ctx context.Context, query SearchQuery) ([]RadioStation, error) {
+	if query.isEmpty() {
+		return nil, errors.New("empty search query")
+	}
+
+	params := url.Values{}
+	if query.Name != "" {
+		params.Set("name", query.Name)
+	}
+	for key, value := range query.Filters {
+		params.Set(key, value)
+	}
+	params.Set("limit", strconv.Itoa(searchLimit))
+	params.Set("order", "clickcount")
+	params.Set("reverse", "true")
+
+	resp, err := radioBrowserGet(ctx, "/json/stations/search", params)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result, err := decodeStations(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].popularity() > result[j].popularity()
+	})
+
+	return result, nil
+}
+
+// decodeStations reads a list of stations answered by radio-browser.
+func decodeStations(r io.Reader) ([]RadioStation, error) {
+	var stations []struct {
+		Name        string `json:"name"`
+		URLResolved string `json:"url_resolved"`
+		Votes       int    `json:"votes"`
+		ClickCount  int    `json:"clickcount"`
+		Favicon     string `json:"favicon"`
+		Homepage    string `json:"homepage"`
+	}
+	// Proxies in front of a mirror may answer with an HTML error page.
+	err := json.NewDecoder(r).Decode(&stations)
+	if err != nil {
+		return nil, unavailableError(fmt.Errorf("invalid response: %w", err))
+	}
+
+	result := make([]RadioStation, len(stations))
+	for i, s := range stations {
+		result[i] = RadioStation{
+			Name:       s.Name,
+			URL:        s.URLResolved,
+			Votes:      s.Votes,
+			ClickCount: s.ClickCount,
+			Favicon:    s.Favicon,
+			Homepage:   s.Homepage,
+		}
+	}
+
+	return result, nil
+}
+
+// popularity scores how reliable a station from radio-browser is likely to
+// be, based on how often it is played and voted for.
+func (rs RadioStation) popularity() int {
+	return rs.ClickCount + rs.Votes
+}
+
+// SearchResults are the stations found by a user's last search, along with
+// the page of results they are looking at.
+type SearchResults struct {
+	Stations []RadioStation
+	Page     int
+	storedAt time.Time
+}
+
+func (sr *SearchResults) pageCount() int {
+	return (len(sr.Stations) + searchPageSize - 1) / searchPageSize
+}
+
+// searchResultsJanitorInterval is how often expired search results are
+// dropped.
+const searchResultsJanitorInterval = time.Minute
+
+// storeSearchResults saves the stations found for a user and returns a copy
+// of the new results. The oldest results of other users are dropped to stay
+// within settings.SearchResultsLimit.
+func storeSearchResults(userID string, stations []RadioStation) SearchResults {
+	searchResultsMutex.Lock()
+	defer searchResultsMutex.Unlock()
+
+	delete(searchResults, userID)
+	for len(searchResults) > 0 && len(searchResults) >= settings.SearchResultsLimit {
+		evictOldestSearchResults()
+	}
+
+	sr := &SearchResults{Stations: stations, storedAt: time.Now()}
+	searchResults[userID] = sr
+	return *sr
+}
+
+// evictOldestSearchResults drops the results stored longest ago. The caller
+// must hold searchResultsMutex.
+func evictOldestSearchResults() {
+	oldestID := ""
+	var oldest time.Time
+	for id, sr := range searchResults {
+		if oldestID == "" || sr.storedAt.Before(oldest) {
+			oldestID, oldest = id, sr.storedAt
+		}
+	}
+	delete(searchResults, oldestID)
+}
+
+// expireSearchResults drops search results that are past
+// settings.SearchResultsTTL, so users who searched once don't hold on to
+// memory for the rest of the bot's lifetime.
+func expireSearchResults() {
+	ticker := time.NewTicker(searchResultsJanitorInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		searchResultsMutex.Lock()
+		for id, sr := range searchResults {
+			if time.Since(sr.storedAt) > settings.SearchResultsTTL {
+				delete(searchResults, id)
+			}
+		}
+		searchResultsMutex.Unlock()
+	}
+}
+
+// getSearchResults returns a copy of the unexpired search results for a user
+// after moving the page cursor by pageDelta, clamped to the valid pages.
+func getSearchResults(userID string, pageDelta int) (SearchResults, bool) {
+	searchResultsMutex.Lock()
+	defer searchResultsMutex.Unlock()
+
+	sr, ok := searchResults[userID]
+	if !ok {
+		return SearchResults{}, false
+	}
+	if time.Since(sr.storedAt) > settings.SearchResultsTTL {
+		delete(searchResults, userID)
+		return SearchResults{}, false
+	}
+
+	sr.Page = max(0, min(sr.Page+pageDelta, sr.pageCount()-1))
+	return *sr, true
+}
+
+// replyNoSearchResults tells the user there are no search results to use,
+// either because they didn't search or because the results expired.
+func replyNoSearchResults(r Responder) {
+	r.ReplyError(fmt.Sprintf("No search results found, they are kept for %s. Use `%ssearchradio` to search again.", formatUptime(settings.SearchResultsTTL), commandPrefix(r.GuildID())))
+}
+
+// replySearchError explains why a radio-browser request failed.
+func replySearchError(r Responder, err error) {
+	switch {
+	case errors.Is(err, errSearchTimeout):
+		r.ReplyError("The search timed out, the radio directory isn't answering. Please try again later.")
+	case errors.Is(err, errRadioBrowserUnavailable):
+		r.ReplyError("The radio directory is having issues right now. Please try again in a bit.")
+	default:
+		r.ReplyError("Error searching for radio stations.")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// searchCache keeps the results of recent radio-browser searches, so the
+// same query from any user is answered without calling the API again. The
+// least recently used query is evicted once the cache is full.
+type searchCache struct {
+	ttl     time.Duration
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+	mu      sync.Mutex
+}
+
+type searchCacheEntry struct {
+	key      string
+	stations []RadioStation
+	storedAt time.Time
+}
+
+func newSearchCache(ttl time.Duration, size int) *searchCache {
+	return &searchCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// searchResultsCache is created in main once the settings are loaded.
+var searchResultsCache *searchCache
+
+// key normalizes a query so searches differing only in case, spacing or the
+// order of the filters share an entry.
+func (q SearchQuery) key() string {
+	parts := []string{normalizeRadioName(q.Name)}
+	for key, value := range q.Filters {
+		parts = append(parts, key+":"+normalizeRadioName(value))
+	}
+	slices.Sort(parts[1:])
+	return strings.Join(parts, "\x00")
+}
+
+// get returns the stations cached for a query, if they haven't expired.
+func (c *searchCache) get(query SearchQuery) ([]RadioStation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[query.key()]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*searchCacheEntry)
+	if time.Since(entry.storedAt) > c.ttl {
+		c.order.Remove(el)
+		delete(c.entries, entry.key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	return slices.Clone(entry.stations), true
+}
+
+// put caches the stations found for a query.
+func (c *searchCache) put(query SearchQuery, stations []RadioStation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := query.key()
+	if el, ok := c.entries[key]; ok {
+		c.order.Remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&searchCacheEntry{
+		key:      key,
+		stations: slices.Clone(stations),
+		storedAt: time.Now(),
+	})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*searchCacheEntry).key)
+	}
+}
+
+// cachedSearchRadioStations searches radio-browser, serving recent queries
+// from searchResultsCache.
+func cachedSearchRadioStations(ctx context.Context, query SearchQuery) ([]RadioStation, error) {
+	if stations, ok := searchResultsCache.get(query); ok {
+		searchCacheHits.Inc()
+		return stations, nil
+	}
+
+	stations, err := searchRadioStations(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	searchResultsCache.put(query, stations)
+	return stations, nil
+}
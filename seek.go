@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var errInvalidPosition = errors.New("invalid position")
+
+// position returns how far into the current source playback is.
+func (c *Connection) position() time.Duration {
+	return time.Duration(c.playedFrames.Load()) * frameDuration
+}
+
+func (c *Connection) setPosition(position time.Duration) {
+	c.playedFrames.Store(int64(position / frameDuration))
+}
+
+// parseClock parses seconds, m:ss or h:mm:ss.
+func parseClock(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, errInvalidPosition
+	}
+
+	var total time.Duration
+	for i, part := range parts {
+		// Atoi would accept a sign, as in 1:+5.
+		if part == "" || strings.Trim(part, "0123456789") != "" {
+			return 0, errInvalidPosition
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || (i > 0 && (len(part) != 2 || n >= 60)) {
+			return 0, errInvalidPosition
+		}
+		total = total*60 + time.Duration(n)
+	}
+	return total * time.Second, nil
+}
+
+// parseSeekPosition parses the argument of !seek: an absolute position like
+// 1:30 or 90, or an offset from current with a leading + or -, like +30 or
+// -1:00. Positions before the start are clamped to it.
+func parseSeekPosition(arg string, current time.Duration) (time.Duration, error) {
+	sign := time.Duration(0)
+	switch {
+	case strings.HasPrefix(arg, "+"):
+		sign = 1
+	case strings.HasPrefix(arg, "-"):
+		sign = -1
+	}
+	if sign != 0 {
+		arg = arg[1:]
+	}
+
+	d, err := parseClock(arg)
+	if err != nil {
+		return 0, err
+	}
+	if sign != 0 {
+		d = current + sign*d
+	}
+	return max(d, 0), nil
+}
+
+// formatPosition formats d as m:ss, or h:mm:ss past an hour.
+func formatPosition(d time.Duration) string {
+	seconds := int(d / time.Second)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// handleSeek restarts ffmpeg at another position of a finite source, such as
+// a file or a video.
+func handleSeek(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Usage: `%sseek <m:ss|+seconds|-seconds>`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+	if conn.isLive() {
+		r.ReplyError("Can't seek a live stream.")
+		return
+	}
+
+	position, err := parseSeekPosition(args[0], conn.position())
+	if err != nil {
+		r.ReplyError("Positions look like `1:30`, `90`, `+30` or `-1:00`.")
+		return
+	}
+
+	err = restartStream(conn, conn.currentStation().URL, position)
+	if errors.Is(err, errStreamStopped) {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+	if errors.Is(err, errNotDecoding) {
+		r.ReplyError("The stream is starting, reconnecting or between stations right now. Try again in a moment.")
+		return
+	}
+	if err != nil {
+		conn.logger().Println("Error seeking:", err)
+		r.ReplyError(fmt.Sprintf("Couldn't seek to %s, it may be past the end.", formatPosition(position)))
+		return
+	}
+
+	conn.setPosition(position)
+	r.Reply(fmt.Sprintf("Seeked to %s.", formatPosition(position)))
+}
+
+// handleRefresh restarts ffmpeg on the current stream in place, to clear
+// stale buffers of a live stream that drifted or stutters. The voice
+// connection, queue, volume and pause state are kept, and finite sources
+// carry on from where they were.
+func handleRefresh(s *discordgo.Session, r Responder, args []string) {
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	var position time.Duration
+	if !conn.isLive() {
+		position = conn.position()
+	}
+
+	err := restartStream(conn, conn.currentStation().URL, position)
+	if errors.Is(err, errStreamStopped) {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+	if errors.Is(err, errNotDecoding) {
+		r.ReplyError("The stream is starting, reconnecting or between stations right now. Try again in a moment.")
+		return
+	}
+	if err != nil {
+		conn.logger().Println("Error refreshing stream:", err)
+		r.ReplyError("Couldn't refresh the stream, it keeps playing as it was.")
+		return
+	}
+
+	conn.setPosition(position)
+	r.Reply(fmt.Sprintf("Refreshed the stream of %s.", conn.currentRadioName()))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"90", 90 * time.Second, false},
+		{"1:30", 90 * time.Second, false},
+		{"0:05", 5 * time.Second, false},
+		{"61:00", 61 * time.Minute, false},
+		{"1:00:00", time.Hour, false},
+		{"1:02:03", time.Hour + 2*time.Minute + 3*time.Second, false},
+		{"", 0, true},
+		{":30", 0, true},
+		{"1:", 0, true},
+		{"1:5", 0, true},
+		{"1:60", 0, true},
+		{"1:005", 0, true},
+		{"1:+5", 0, true},
+		{"+30", 0, true},
+		{"1:00:60", 0, true},
+		{"1:00:00:00", 0, true},
+		{"-30", 0, true},
+		{"1.5", 0, true},
+		{"1m30s", 0, true},
+		{" 30", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseClock(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, errInvalidPosition) {
+				t.Errorf("parseClock(%q) = %s, %v, want %v", tt.in, got, err, errInvalidPosition)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseClock(%q) = %s, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseSeekPosition(t *testing.T) {
+	const current = 2 * time.Minute
+
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"1:30", 90 * time.Second, false},
+		{"0", 0, false},
+		{"+30", current + 30*time.Second, false},
+		{"+1:00", current + time.Minute, false},
+		{"-30", current - 30*time.Second, false},
+		{"-2:00", 0, false},
+		{"-10:00", 0, false},
+		{"+", 0, true},
+		{"-", 0, true},
+		{"+-5", 0, true},
+		{"++5", 0, true},
+		{"+1:5", 0, true},
+		{"abc", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSeekPosition(tt.in, current)
+		if tt.wantErr {
+			if !errors.Is(err, errInvalidPosition) {
+				t.Errorf("parseSeekPosition(%q) = %s, %v, want %v", tt.in, got, err, errInvalidPosition)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseSeekPosition(%q) = %s, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatPosition(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+	}{
+		{0, "0:00"},
+		{5*time.Second + 900*time.Millisecond, "0:05"},
+		{90 * time.Second, "1:30"},
+		{59*time.Minute + 59*time.Second, "59:59"},
+		{time.Hour + 2*time.Minute + 3*time.Second, "1:02:03"},
+	}
+	for _, tt := range tests {
+		if got := formatPosition(tt.in); got != tt.want {
+			t.Errorf("formatPosition(%s) = %q, want %q", tt.in, got, tt.want)
+		}
+		// What formatPosition shows can be typed back into !seek.
+		if got, err := parseClock(formatPosition(tt.in)); err != nil || got != tt.in.Truncate(time.Second) {
+			t.Errorf("parseClock(formatPosition(%s)) = %s, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"layeh.com/gopus"
+)
+
+const (
+	MinAudioBitrate = 16000
+	MaxAudioBitrate = 128000
+)
+
+type OpusApplicationDecoder gopus.Application
+
+var mapOpusApplication = map[string]gopus.Application{
+	"AUDIO":    gopus.Audio,
+	"VOIP":     gopus.Voip,
+	"LOWDELAY": gopus.RestrictedLowDelay,
+}
+
+func (oad *OpusApplicationDecoder) Decode(value string) error {
+	upper := strings.ToUpper(value)
+	if val, ok := mapOpusApplication[upper]; ok {
+		*oad = OpusApplicationDecoder(val)
+		return nil
+	}
+	return fmt.Errorf("opus application %s is not valid", value)
+}
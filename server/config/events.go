@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EventBroker selects the message broker playback events are published to.
+type EventBroker string
+
+const (
+	EventBrokerNone  EventBroker = "none"
+	EventBrokerNATS  EventBroker = "nats"
+	EventBrokerRedis EventBroker = "redis"
+)
+
+type EventBrokerDecoder EventBroker
+
+var mapEventBroker = map[string]EventBroker{
+	"NONE":  EventBrokerNone,
+	"NATS":  EventBrokerNATS,
+	"REDIS": EventBrokerRedis,
+}
+
+func (ebd *EventBrokerDecoder) Decode(value string) error {
+	upper := strings.ToUpper(value)
+	if val, ok := mapEventBroker[upper]; ok {
+		*ebd = EventBrokerDecoder(val)
+		return nil
+	}
+	return fmt.Errorf("event broker %s is not valid", value)
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is read when CONFIG_FILE is not set, if it exists.
+const defaultConfigFile = "config.yaml"
+
+// fileKeys are the environment variables set from the config file by the
+// last call to applyConfigFile, so reloading can tell them apart from the
+// real environment.
+var fileKeys = map[string]bool{}
+
+// applyConfigFile reads the YAML config file named by CONFIG_FILE and sets
+// each of its settings as an environment variable, unless that variable is
+// already set, so envconfig picks them up with the environment taking
+// precedence. Keys are the environment variable names, in any case, e.g.
+// `command_prefix: "?"`. Lists are joined with commas like envconfig expects.
+// Unknown keys are reported as an error.
+func applyConfigFile() error {
+	for key := range fileKeys {
+		os.Unsetenv(key)
+	}
+	fileKeys = map[string]bool{}
+
+	path, ok := os.LookupEnv("CONFIG_FILE")
+	if !ok {
+		path = defaultConfigFile
+	}
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !ok {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+
+	var values map[string]any
+	err = yaml.Unmarshal(data, &values)
+	if err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	known, err := settingKeys()
+	if err != nil {
+		return err
+	}
+
+	var unknown []string
+	for name, value := range values {
+		key := strings.ToUpper(name)
+		if !known[key] {
+			unknown = append(unknown, name)
+			continue
+		}
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+
+		os.Setenv(key, configValue(value))
+		fileKeys[key] = true
+	}
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		return fmt.Errorf("unknown settings in config file %s: %s", path, strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+// configValue formats a YAML value the way envconfig parses it.
+func configValue(value any) string {
+	list, ok := value.([]any)
+	if !ok {
+		return fmt.Sprint(value)
+	}
+
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = fmt.Sprint(item)
+	}
+	return strings.Join(items, ",")
+}
+
+// settingKeys returns the environment variable names of all settings.
+func settingKeys() (map[string]bool, error) {
+	var out bytes.Buffer
+	err := envconfig.Usagef("", &Settings{}, &out, "{{range .}}{{usage_key .}}\n{{end}}")
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool)
+	for _, key := range strings.Fields(out.String()) {
+		keys[key] = true
+	}
+	return keys, nil
+}
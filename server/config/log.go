@@ -24,3 +24,27 @@ func (lld *LogLevelDecoder) Decode(value string) error {
 	}
 	return fmt.Errorf("log level %s is not valid", value)
 }
+
+// LogFormat selects how log entries are written.
+type LogFormat string
+
+const (
+	LogFormatText LogFormat = "text"
+	LogFormatJSON LogFormat = "json"
+)
+
+type LogFormatDecoder LogFormat
+
+var mapLogFormat = map[string]LogFormat{
+	"TEXT": LogFormatText,
+	"JSON": LogFormatJSON,
+}
+
+func (lfd *LogFormatDecoder) Decode(value string) error {
+	upper := strings.ToUpper(value)
+	if val, ok := mapLogFormat[upper]; ok {
+		*lfd = LogFormatDecoder(val)
+		return nil
+	}
+	return fmt.Errorf("log format %s is not valid", value)
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PauseTimeoutAction is what happens to a stream paused for longer than
+// MaxPauseDuration.
+type PauseTimeoutAction string
+
+const (
+	PauseTimeoutResume     PauseTimeoutAction = "resume"
+	PauseTimeoutDisconnect PauseTimeoutAction = "disconnect"
+)
+
+type PauseTimeoutActionDecoder PauseTimeoutAction
+
+var mapPauseTimeoutAction = map[string]PauseTimeoutAction{
+	"RESUME":     PauseTimeoutResume,
+	"DISCONNECT": PauseTimeoutDisconnect,
+}
+
+func (ptd *PauseTimeoutActionDecoder) Decode(value string) error {
+	upper := strings.ToUpper(value)
+	if val, ok := mapPauseTimeoutAction[upper]; ok {
+		*ptd = PauseTimeoutActionDecoder(val)
+		return nil
+	}
+	return fmt.Errorf("pause timeout action %s is not valid", value)
+}
@@ -1,15 +1,239 @@
 package config
 
-import "github.com/kelseyhightower/envconfig"
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	log "github.com/sirupsen/logrus"
+)
 
 type Settings struct {
-	DiscordToken string          `split_words:"true" required:"true"`
-	LogLevel     LogLevelDecoder `split_words:"true" default:"info"`
+	DiscordToken  string           `split_words:"true"`
+	LogLevel      LogLevelDecoder  `split_words:"true" default:"info"`
+	LogFormat     LogFormatDecoder `split_words:"true" default:"text"`
+	CommandPrefix string           `split_words:"true" default:"!"`
+
+	// Normalize enables loudness normalization for new streams by default.
+	// It uses ffmpeg's loudnorm filter, which costs extra CPU per stream.
+	Normalize bool `default:"false"`
+
+	// AudioBitrate is the highest Opus bitrate in bits per second, clamped
+	// to 16000-128000. Streams are encoded at the bitrate of their voice
+	// channel up to it, since Discord caps regular channels at 96kbps and
+	// boosted servers allow 128kbps or more.
+	AudioBitrate     int                    `split_words:"true" default:"96000"`
+	AudioApplication OpusApplicationDecoder `split_words:"true" default:"audio"`
+
+	// AudioBufferFrames is how many 20ms frames are decoded ahead of the
+	// sender to ride out stalls of the stream.
+	AudioBufferFrames int `split_words:"true" default:"50"`
+
+	// OpusPassthrough sends Opus streams in 20ms frames to Discord without
+	// decoding and re-encoding them, which saves most of the CPU of a
+	// stream. The volume and normalization can't apply to the packets, so
+	// they only pass through at 100% volume with normalization off, and
+	// changing either switches the stream back to re-encoding.
+	OpusPassthrough bool `split_words:"true" default:"false"`
+
+	// MaxVolume is the highest volume percentage users may set. Values above
+	// 100 amplify the stream, and loud stations will clip.
+	MaxVolume int `split_words:"true" default:"100"`
+
+	// DefaultVolume is the volume percentage streams start at in guilds
+	// that haven't set one. The volume last set in a guild takes precedence.
+	DefaultVolume int `split_words:"true" default:"100"`
+
+	// AutoResume restarts the streams that were playing when the bot shut
+	// down, as long as their voice channels still have listeners.
+	AutoResume bool `split_words:"true" default:"false"`
+
+	// ResumeConcurrency is how many guilds auto-resume rejoins at a time,
+	// each worker waiting ResumeInterval between joins. Rate limited joins
+	// pause all workers and are retried.
+	ResumeConcurrency int           `split_words:"true" default:"1"`
+	ResumeInterval    time.Duration `split_words:"true" default:"2s"`
+
+	// ReconnectAttempts is how many times a dropped stream or voice
+	// connection is retried, waiting ReconnectDelay before the first retry
+	// and twice as long before each next one, up to a minute.
+	ReconnectAttempts int           `split_words:"true" default:"3"`
+	ReconnectDelay    time.Duration `split_words:"true" default:"1s"`
+
+	// ReconnectNotifyAfter is how many consecutive reconnects of a stream
+	// it takes before the channel is told it's having trouble, and
+	// ReconnectRecoveredAfter how long it must play again before it's
+	// reported back. Zero never reports the trouble. Every reconnect is
+	// logged either way.
+	ReconnectNotifyAfter    int           `split_words:"true" default:"2"`
+	ReconnectRecoveredAfter time.Duration `split_words:"true" default:"30s"`
+
+	// CommandInterval is how often a user regains a command, allowing bursts
+	// of CommandBurst commands. A zero interval disables rate limiting.
+	// AdminUserIDs are never rate limited and, like OwnerID, may reload
+	// the settings and change the log level of the whole bot.
+	CommandInterval time.Duration `split_words:"true" default:"2s"`
+	CommandBurst    int           `split_words:"true" default:"5"`
+	AdminUserIDs    []string      `envconfig:"ADMIN_USER_IDS"`
+
+	// OwnerID is the user ID of the bot operator, who may list the streams
+	// of all servers with !active in a DM.
+	OwnerID string `envconfig:"OWNER_ID"`
+
+	// SearchCacheTTL is how long radio-browser search results are reused,
+	// for up to SearchCacheSize queries. Zero disables the cache.
+	SearchCacheTTL  time.Duration `split_words:"true" default:"10m"`
+	SearchCacheSize int           `split_words:"true" default:"100"`
+
+	// SearchResultsTTL is how long the results of a user's last search can
+	// be browsed and played from. At most SearchResultsLimit users keep
+	// their results, the oldest are dropped first.
+	SearchResultsTTL   time.Duration `split_words:"true" default:"10m"`
+	SearchResultsLimit int           `split_words:"true" default:"1000"`
+
+	// MaxStreamDuration stops a stream after it has been connected this
+	// long, even with listeners left. Zero disables the limit.
+	MaxStreamDuration time.Duration `split_words:"true" default:"0"`
+
+	// MaxPauseDuration is how long a stream may stay paused before
+	// PauseTimeoutAction "resume" plays it again or "disconnect" leaves the
+	// voice channel. Zero lets streams stay paused.
+	MaxPauseDuration   time.Duration             `split_words:"true" default:"30m"`
+	PauseTimeoutAction PauseTimeoutActionDecoder `split_words:"true" default:"disconnect"`
+
+	// VoteSkipRatio is the share of listeners that must vote to skip a
+	// station with !voteskip. A station is skipped once more than this share
+	// of the non-bot members in the voice channel voted.
+	VoteSkipRatio float64 `split_words:"true" default:"0.5"`
+
+	// Store selects where custom radios and favorites are kept: "json" files
+	// in the working directory, or "sqlite" at DatabasePath. The JSON files
+	// are imported into a new database on first run.
+	Store        StoreDriverDecoder `default:"json"`
+	DatabasePath string             `split_words:"true" default:"radio-bot.db"`
+
+	// FFmpegPath is the ffmpeg binary used to decode streams.
+	// FFmpegInputArgs are extra comma-separated input options for HTTP
+	// streams, e.g. "-rw_timeout,10000000".
+	FFmpegPath      string   `envconfig:"FFMPEG_PATH" default:"ffmpeg"`
+	FFmpegInputArgs []string `envconfig:"FFMPEG_INPUT_ARGS"`
+
+	// AllowPrivateStreams lets users play and add stream URLs on private,
+	// loopback and link-local addresses. Leave it off when the bot runs next
+	// to services that shouldn't be reachable, like cloud metadata endpoints.
+	AllowPrivateStreams bool `split_words:"true" default:"false"`
+
+	// UserAgent replaces the User-Agent sent to radio-browser and stream
+	// servers, which defaults to radio-bot/<version>.
+	UserAgent string `split_words:"true"`
+
+	// StationsFile is a JSON object mapping the names of the built-in
+	// stations to their stream URLs.
+	StationsFile string `split_words:"true" default:"stations.json"`
+
+	// AudioFilesDir is the only directory !playfile may read files from.
+	AudioFilesDir string `split_words:"true" default:"audio"`
+
+	// TTSAnnounce speaks "Now playing <station>" in the voice channel before
+	// each station starts, using TTSCommand (espeak-ng or a compatible
+	// engine that writes WAV with --stdout).
+	TTSAnnounce bool   `envconfig:"TTS_ANNOUNCE" default:"false"`
+	TTSCommand  string `envconfig:"TTS_COMMAND" default:"espeak-ng"`
+
+	// YTDLPPath is the yt-dlp binary used to play YouTube and similar links.
+	YTDLPPath string `envconfig:"YTDLP_PATH" default:"yt-dlp"`
+
+	// RadioBrowserServer pins the radio-browser mirror used for searches,
+	// e.g. "https://de1.api.radio-browser.info", instead of discovering them.
+	RadioBrowserServer string `split_words:"true"`
+
+	// WebhookURL receives a JSON POST when streams start, stop, fail or
+	// reconnect.
+	WebhookURL string `split_words:"true"`
+
+	// EventBroker publishes the webhook events to "nats" or "redis" pub/sub
+	// at EventBrokerURL, e.g. "nats://localhost:4222" or
+	// "redis://:password@localhost:6379", on the subject or channel
+	// EventSubject. Events are dropped while the broker is unreachable.
+	EventBroker    EventBrokerDecoder `split_words:"true" default:"none"`
+	EventBrokerURL string             `split_words:"true"`
+	EventSubject   string             `split_words:"true" default:"radio-bot.events"`
+
+	// HTTPAddr enables the remote control API when set, e.g. ":8080".
+	HTTPAddr  string `split_words:"true"`
+	HTTPToken string `split_words:"true"`
+
+	// HealthAddr serves the /healthz and /readyz checks for container
+	// orchestration when set, e.g. ":8081". They need no token.
+	HealthAddr string `split_words:"true"`
 }
 
+// LoadSettings reads the settings from the environment, falling back to the
+// YAML file named by CONFIG_FILE (config.yaml by default) for the variables
+// that are not set.
 func LoadSettings() (Settings, error) {
 	var settings Settings
-	err := envconfig.Process("", &settings)
+	err := applyConfigFile()
+	if err != nil {
+		return settings, err
+	}
+
+	err = envconfig.Process("", &settings)
+	if err != nil {
+		return settings, err
+	}
+
+	err = ValidateDiscordToken(settings.DiscordToken)
+	if err != nil {
+		return settings, err
+	}
+
+	if settings.HTTPAddr != "" && settings.HTTPToken == "" {
+		return settings, ErrHTTPTokenMissing
+	}
+
+	if settings.ReconnectAttempts < 1 {
+		return settings, ErrReconnectAttempts
+	}
+	if settings.ReconnectDelay <= 0 {
+		return settings, ErrReconnectDelay
+	}
+
+	if settings.AudioBitrate < MinAudioBitrate || settings.AudioBitrate > MaxAudioBitrate {
+		clamped := max(MinAudioBitrate, min(settings.AudioBitrate, MaxAudioBitrate))
+		log.Warnf("Audio bitrate %d is out of range, using %d", settings.AudioBitrate, clamped)
+		settings.AudioBitrate = clamped
+	}
+
+	if settings.AudioBufferFrames < 1 {
+		log.Warnf("Audio buffer of %d frames is too small, using 1", settings.AudioBufferFrames)
+		settings.AudioBufferFrames = 1
+	}
+
+	if settings.ResumeConcurrency < 1 {
+		log.Warnf("Resume concurrency %d is too small, using 1", settings.ResumeConcurrency)
+		settings.ResumeConcurrency = 1
+	}
+
+	if settings.SearchResultsLimit < 1 {
+		log.Warnf("Search results limit %d is too small, using 1", settings.SearchResultsLimit)
+		settings.SearchResultsLimit = 1
+	}
+
+	if settings.MaxVolume < 100 {
+		log.Warnf("Max volume %d is below 100, using 100", settings.MaxVolume)
+		settings.MaxVolume = 100
+	}
+
+	if settings.DefaultVolume < 0 || settings.DefaultVolume > 100 {
+		clamped := max(0, min(settings.DefaultVolume, 100))
+		log.Warnf("Default volume %d is out of range, using %d", settings.DefaultVolume, clamped)
+		settings.DefaultVolume = clamped
+	}
+
+	if settings.VoteSkipRatio < 0 || settings.VoteSkipRatio >= 1 {
+		log.Warnf("Vote skip ratio %g is out of range, using 0.5", settings.VoteSkipRatio)
+		settings.VoteSkipRatio = 0.5
+	}
 
-	return settings, err
+	return settings, nil
 }
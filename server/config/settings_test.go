@@ -0,0 +1,39 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLoadSettingsReconnect(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts string
+		delay    string
+		want     error
+	}{
+		{"defaults", "", "", nil},
+		{"set", "5", "500ms", nil},
+		{"no attempts", "0", "", ErrReconnectAttempts},
+		{"negative attempts", "-1", "", ErrReconnectAttempts},
+		{"no delay", "", "0s", ErrReconnectDelay},
+		{"negative delay", "", "-1s", ErrReconnectDelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("DISCORD_TOKEN", validToken)
+			if tt.attempts != "" {
+				t.Setenv("RECONNECT_ATTEMPTS", tt.attempts)
+			}
+			if tt.delay != "" {
+				t.Setenv("RECONNECT_DELAY", tt.delay)
+			}
+
+			_, err := LoadSettings()
+			if !errors.Is(err, tt.want) {
+				t.Errorf("LoadSettings = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StoreDriver selects where custom radios and favorites are kept.
+type StoreDriver string
+
+const (
+	StoreJSON   StoreDriver = "json"
+	StoreSQLite StoreDriver = "sqlite"
+)
+
+type StoreDriverDecoder StoreDriver
+
+var mapStoreDriver = map[string]StoreDriver{
+	"JSON":   StoreJSON,
+	"SQLITE": StoreSQLite,
+}
+
+func (sdd *StoreDriverDecoder) Decode(value string) error {
+	upper := strings.ToUpper(value)
+	if val, ok := mapStoreDriver[upper]; ok {
+		*sdd = StoreDriverDecoder(val)
+		return nil
+	}
+	return fmt.Errorf("store %s is not valid", value)
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrTokenMissing = errors.New("DISCORD_TOKEN is not set, copy the bot token from the Bot page of your application in the Discord Developer Portal")
+	ErrTokenInvalid = errors.New("DISCORD_TOKEN does not look like a bot token")
+
+	ErrHTTPTokenMissing = errors.New("HTTP_TOKEN must be set when HTTP_ADDR is enabled")
+
+	ErrReconnectAttempts = errors.New("RECONNECT_ATTEMPTS must be at least 1")
+	ErrReconnectDelay    = errors.New("RECONNECT_DELAY must be positive")
+)
+
+// ValidateDiscordToken checks that token is shaped like a bot token: three
+// dot-separated base64 parts, the first of which encodes the numeric ID of
+// the bot. It can't tell whether Discord accepts the token.
+func ValidateDiscordToken(token string) error {
+	if token == "" {
+		return ErrTokenMissing
+	}
+
+	if strings.HasPrefix(token, "Bot ") {
+		return fmt.Errorf("%w: leave out the \"Bot \" prefix, it is added automatically", ErrTokenInvalid)
+	}
+	if strings.TrimSpace(token) != token || strings.Trim(token, `"'`) != token {
+		return fmt.Errorf("%w: remove the surrounding spaces or quotes", ErrTokenInvalid)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return fmt.Errorf("%w: it should have three parts separated by dots", ErrTokenInvalid)
+	}
+
+	id, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[0], "="))
+	if err != nil || len(id) == 0 || strings.Trim(string(id), "0123456789") != "" {
+		return fmt.Errorf("%w: its first part should encode the ID of the bot", ErrTokenInvalid)
+	}
+
+	return nil
+}
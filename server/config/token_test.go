@@ -0,0 +1,38 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+// validToken is shaped like a bot token, with "123456789012345678" as the
+// ID of the bot.
+const validToken = "MTIzNDU2Nzg5MDEyMzQ1Njc4.GhIjKl.abcdefghijklmnopqrstuvwxyz0123456789AB"
+
+func TestValidateDiscordToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"valid", validToken, nil},
+		{"missing", "", ErrTokenMissing},
+		{"Bot prefix", "Bot " + validToken, ErrTokenInvalid},
+		{"surrounding spaces", " " + validToken + "\n", ErrTokenInvalid},
+		{"quoted", `"` + validToken + `"`, ErrTokenInvalid},
+		{"two parts", "MTIzNDU2Nzg5MDEyMzQ1Njc4.GhIjKl", ErrTokenInvalid},
+		{"four parts", validToken + ".extra", ErrTokenInvalid},
+		{"empty part", "MTIzNDU2Nzg5MDEyMzQ1Njc4..abcdef", ErrTokenInvalid},
+		{"ID not base64", "not*base64.GhIjKl.abcdef", ErrTokenInvalid},
+		{"ID not numeric", "Ym90.GhIjKl.abcdef", ErrTokenInvalid},
+		{"client secret", "abcdefghijklmnopqrstuvwxyz012345", ErrTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDiscordToken(tt.token)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ValidateDiscordToken(%q) = %v, want %v", tt.token, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// slashCommandNames maps slash commands to the text command handler they
+// share when the names differ.
+var slashCommandNames = map[string]string{
+	"search": "searchradio",
+}
+
+// splitOptions are the string options that hold several arguments.
+var splitOptions = map[string]bool{
+	"keywords": true,
+}
+
+// slowCommands probe streams, join voice channels or call other services,
+// which can take longer than the 3 seconds Discord waits for an answer, so
+// the interaction is acknowledged before they run.
+var slowCommands = map[string]bool{
+	"playradio":    true,
+	"play":         true,
+	"playfile":     true,
+	"playstation":  true,
+	"playfav":      true,
+	"replay":       true,
+	"searchradio":  true,
+	"suggest":      true,
+	"testradio":    true,
+	"importradios": true,
+	"exportradios": true,
+	"join":         true,
+	"move":         true,
+	"refresh":      true,
+}
+
+var slashCommands = []*discordgo.ApplicationCommand{
+	{
+		Name:        "help",
+		Description: "Display the list of available commands",
+	},
+	{
+		Name:        "playradio",
+		Description: "Play a predefined or custom radio station",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "radio",
+				Description: "Name of the radio station",
+				Required:    true,
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionChannel,
+				Name:         "channel",
+				Description:  "Voice channel to play in instead of your own",
+				ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildVoice, discordgo.ChannelTypeGuildStageVoice},
+			},
+		},
+	},
+	{
+		Name:        "play",
+		Description: "Play a stream URL, a YouTube link or a radio station",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "url",
+				Description: "Stream URL, YouTube link or radio station name",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "playfile",
+		Description: "Play an uploaded audio file (admins only)",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionAttachment,
+				Name:        "file",
+				Description: "Audio file to play",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "enqueue",
+		Description: "Add a radio station to the queue",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "radio",
+				Description: "Name of the radio station",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "queue",
+		Description: "List the queued radio stations",
+	},
+	{
+		Name:        "shuffle",
+		Description: "Put the queued radio stations in a random order",
+	},
+	{
+		Name:        "clear",
+		Description: "Empty the queue without stopping the current station",
+	},
+	{
+		Name:        "skip",
+		Description: "Skip to the next queued radio station",
+	},
+	{
+		Name:        "voteskip",
+		Description: "Vote to skip the current station",
+	},
+	{
+		Name:        "nowplaying",
+		Description: "Show the track currently playing on the station",
+	},
+	{
+		Name:        "status",
+		Description: "Show the playback status for this server",
+	},
+	{
+		Name:        "stats",
+		Description: "Show the most listened stations, or the numbers of one station",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "radio",
+				Description: "Name of the radio station",
+			},
+		},
+	},
+	{
+		Name:        "stop",
+		Description: "Stop playing and disconnect from the voice channel",
+	},
+	{
+		Name:        "seek",
+		Description: "Jump within a file or video",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "position",
+				Description: "Position like 1:30, or +30/-30 to move by seconds",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "refresh",
+		Description: "Restart the current stream in place to clear a stale buffer",
+	},
+	{
+		Name:        "join",
+		Description: "Join your voice channel without playing anything yet",
+	},
+	{
+		Name:        "move",
+		Description: "Move the stream to your voice channel without restarting it",
+	},
+	{
+		Name:        "leave",
+		Description: "Stop playing and leave the voice channel",
+	},
+	{
+		Name:        "replay",
+		Description: "Play the last station again after it stopped",
+	},
+	{
+		Name:        "sleep",
+		Description: "Stop playing after the given number of minutes",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "minutes",
+				Description: "Minutes until playback stops, 0 cancels the timer",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "listradios",
+		Description: "List all available radio stations",
+	},
+	{
+		Name:        "volume",
+		Description: "Set, change or show the volume level",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "level",
+				Description: "Volume level in percent, or +N/-N to change it by a step",
+			},
+		},
+	},
+	{
+		Name:        "mute",
+		Description: "Silence the stream without pausing it",
+	},
+	{
+		Name:        "unmute",
+		Description: "Restore the volume of a muted stream",
+	},
+	{
+		Name:        "pause",
+		Description: "Pause the current stream",
+	},
+	{
+		Name:        "resume",
+		Description: "Resume a paused stream",
+	},
+	{
+		Name:        "normalize",
+		Description: "Even out loudness between stations",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "mode",
+				Description: "Turn normalization on or off",
+				Required:    true,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "on", Value: "on"},
+					{Name: "off", Value: "off"},
+				},
+			},
+		},
+	},
+	{
+		Name:        "loop",
+		Description: "Replay the current station when it ends, or repeat the queue",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "mode",
+				Description: "What to loop",
+				Required:    true,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "on", Value: "on"},
+					{Name: "queue", Value: "queue"},
+					{Name: "off", Value: "off"},
+				},
+			},
+		},
+	},
+	{
+		Name:        "crossfade",
+		Description: "Fade between stations when switching",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "seconds",
+				Description: "Length of the fade, 0 turns it off",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "search",
+		Description: "Search for radio stations by keywords",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "keywords",
+				Description: "Keywords to search for",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "searchnext",
+		Description: "Show the next page of search results",
+	},
+	{
+		Name:        "searchprev",
+		Description: "Show the previous page of search results",
+	},
+	{
+		Name:        "suggest",
+		Description: "List popular radio stations",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "country",
+				Description: "Country name or two letter code, instead of the one set for this server",
+			},
+		},
+	},
+	{
+		Name:        "playstation",
+		Description: "Play a radio station from the search results",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "number",
+				Description: "Number of the station in the search results",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "addradio",
+		Description: "Add a custom radio station",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "stream_url",
+				Description: "URL of the audio stream",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "radio_name",
+				Description: "Name for the radio station",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "category",
+				Description: "Category to list the radio station under",
+			},
+		},
+	},
+	{
+		Name:        "removeradio",
+		Description: "Remove a custom radio station",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "radio_name",
+				Description: "Name of the custom radio station",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "renameradio",
+		Description: "Rename a custom radio station",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "old_name",
+				Description: "Current name of the custom radio station",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "new_name",
+				Description: "New name for the radio station",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "importradios",
+		Description: "Add the radio stations of a JSON or CSV list (admins only)",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionAttachment,
+				Name:        "file",
+				Description: "JSON or CSV file with the name and url of each station",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "url",
+				Description: "URL of the list, instead of a file",
+			},
+		},
+	},
+	{
+		Name:        "exportradios",
+		Description: "Get the custom radio stations as a JSON file in a DM",
+	},
+	{
+		Name:        "reloadstations",
+		Description: "Reload the built-in stations from the stations file (admins only)",
+	},
+	{
+		Name:        "reload",
+		Description: "Reload the log level, default prefix, stations and custom radios (admins only)",
+	},
+	{
+		Name:        "loglevel",
+		Description: "Change the log level (admins only)",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "level",
+				Description: "New log level",
+				Required:    true,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "debug", Value: "debug"},
+					{Name: "info", Value: "info"},
+					{Name: "warn", Value: "warn"},
+					{Name: "error", Value: "error"},
+				},
+			},
+		},
+	},
+	{
+		Name:        "favorite",
+		Description: "Add a radio station to your favorites",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "radio_name",
+				Description: "Name of the radio station",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "unfavorite",
+		Description: "Remove a radio station from your favorites",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "radio_name",
+				Description: "Name of the radio station",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "favorites",
+		Description: "List your favorite radio stations",
+	},
+	{
+		Name:        "playfav",
+		Description: "Play one of your favorite radio stations",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "number",
+				Description: "Number of the favorite in your list",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "setcountry",
+		Description: "Set the country suggestions list stations from",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "country",
+				Description: "Country name or two letter code, or none for everywhere",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "setprefix",
+		Description: "Change the command prefix for this server",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "prefix",
+				Description: "New prefix for text commands",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "setdjrole",
+		Description: "Set the role allowed to stop, skip, change the volume and remove radios",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionRole,
+				Name:        "role",
+				Description: "Role allowed to use the restricted commands",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "version",
+		Description: "Show which build of the bot is running",
+	},
+	{
+		Name:        "settings",
+		Description: "Show the settings of this server",
+	},
+	{
+		Name:        "set",
+		Description: "Change a setting of this server",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "key",
+				Description: "Setting to change",
+				Required:    true,
+				Choices:     guildSettingChoices(),
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "value",
+				Description: "New value, or default to reset it",
+				Required:    true,
+			},
+		},
+	},
+}
+
+// registerSlashCommands replaces the global application commands of the bot
+// with slashCommands in a single request, so a restart doesn't run into the
+// rate limit of creating them one by one.
+func registerSlashCommands(s *discordgo.Session) {
+	_, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, "", slashCommands)
+	if err != nil {
+		log.Println("Error registering slash commands:", err)
+	}
+}
+
+func onInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+
+	data := i.ApplicationCommandData()
+
+	name := data.Name
+	if alias, ok := slashCommandNames[name]; ok {
+		name = alias
+	}
+
+	args := make([]string, 0, len(data.Options))
+	for _, option := range data.Options {
+		switch option.Type {
+		case discordgo.ApplicationCommandOptionString:
+			// Each option is one argument, so names may contain spaces,
+			// except search keywords which take the same syntax as text.
+			if splitOptions[option.Name] {
+				args = append(args, splitArgs(option.StringValue())...)
+			} else {
+				args = append(args, option.StringValue())
+			}
+		case discordgo.ApplicationCommandOptionInteger:
+			args = append(args, strconv.FormatInt(option.IntValue(), 10))
+		case discordgo.ApplicationCommandOptionAttachment:
+			if data.Resolved != nil {
+				if a, ok := data.Resolved.Attachments[fmt.Sprint(option.Value)]; ok {
+					args = append(args, a.URL)
+				}
+			}
+		default:
+			args = append(args, fmt.Sprint(option.Value))
+		}
+	}
+
+	r := &interactionResponder{s: s, i: i}
+	if slowCommands[name] {
+		r.deferReply()
+	}
+	handleCommand(s, r, name, args)
+}
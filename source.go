@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Source is where a station's audio comes from.
+type Source interface {
+	// Probe checks that the source looks playable before joining a channel.
+	Probe() error
+	// StreamURL returns the URL ffmpeg should read. It is called again on
+	// every reconnect, since resolved URLs may expire.
+	StreamURL() (string, error)
+	// Live reports whether the source plays endlessly, so reaching its end
+	// means it dropped rather than finished.
+	Live() bool
+}
+
+// radioSource is an internet radio stream, possibly behind a playlist.
+type radioSource struct {
+	url string
+}
+
+func (rs radioSource) Probe() error {
+	return probeStream(rs.url)
+}
+
+func (rs radioSource) StreamURL() (string, error) {
+	streamURL, err := resolveStreamURL(rs.url)
+	if err != nil {
+		return "", err
+	}
+
+	// ffmpeg connects on its own, so check where the URL points first.
+	err = checkStreamURL(streamURL)
+	if err != nil {
+		return "", err
+	}
+	return streamURL, nil
+}
+
+func (rs radioSource) Live() bool { return true }
+
+// fileSource is a local audio file.
+type fileSource struct {
+	path string
+}
+
+func (fs fileSource) Probe() error {
+	_, err := os.Stat(fs.path)
+	return err
+}
+
+func (fs fileSource) StreamURL() (string, error) { return fs.path, nil }
+func (fs fileSource) Live() bool                 { return false }
+
+// sourceFor returns the source that can play streamURL.
+func sourceFor(streamURL string) Source {
+	if filepath.IsAbs(streamURL) {
+		return fileSource{path: streamURL}
+	}
+	if isYTDLPURL(streamURL) {
+		return ytdlpSource{url: streamURL}
+	}
+	return radioSource{url: streamURL}
+}
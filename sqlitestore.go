@@ -0,0 +1,251 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS custom_radios (
+	name     TEXT PRIMARY KEY,
+	url      TEXT NOT NULL,
+	category TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS favorites (
+	user_id    TEXT NOT NULL,
+	radio_name TEXT NOT NULL,
+	position   INTEGER NOT NULL,
+	PRIMARY KEY (user_id, radio_name)
+);
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);`
+
+// sqliteStore keeps the custom radios and favorites in a SQLite database,
+// which several bot instances can share.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func newSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(sqliteSchema)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating schema: %w", err)
+	}
+
+	ss := &sqliteStore{db: db}
+	err = ss.addCategoryColumn()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error adding radio categories: %w", err)
+	}
+
+	err = ss.importJSON(radiosFile, favoritesFile)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error importing JSON files: %w", err)
+	}
+
+	return ss, nil
+}
+
+// addCategoryColumn adds the category of custom radios to databases created
+// before radios had one.
+func (ss *sqliteStore) addCategoryColumn() error {
+	var exists bool
+	err := ss.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pragma_table_info('custom_radios') WHERE name = 'category')`).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = ss.db.Exec(`ALTER TABLE custom_radios ADD COLUMN category TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+// importJSON copies the radios and favorites of the JSON store into the
+// database the first time it is opened.
+func (ss *sqliteStore) importJSON(radiosPath, favoritesPath string) error {
+	var imported string
+	err := ss.db.QueryRow(`SELECT value FROM meta WHERE key = 'json_imported'`).Scan(&imported)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	js, err := newJSONStore(radiosPath, favoritesPath)
+	if err != nil {
+		return err
+	}
+
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for name, radio := range js.radios {
+		_, err = tx.Exec(`INSERT OR IGNORE INTO custom_radios (name, url, category) VALUES (?, ?, ?)`, name, radio.URL, radio.Category)
+		if err != nil {
+			return err
+		}
+	}
+	for userID, names := range js.favorites {
+		for i, name := range names {
+			_, err = tx.Exec(`INSERT OR IGNORE INTO favorites (user_id, radio_name, position) VALUES (?, ?, ?)`, userID, name, i+1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err = tx.Exec(`INSERT INTO meta (key, value) VALUES ('json_imported', datetime('now'))`)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Imported %d custom radios and the favorites of %d users into the database", len(js.radios), len(js.favorites))
+	return nil
+}
+
+// Reload does nothing, since every query reads the database.
+func (ss *sqliteStore) Reload() error {
+	return nil
+}
+
+func (ss *sqliteStore) CustomRadio(name string) (CustomRadio, bool, error) {
+	var radio CustomRadio
+	err := ss.db.QueryRow(`SELECT url, category FROM custom_radios WHERE name = ?`, name).Scan(&radio.URL, &radio.Category)
+	if errors.Is(err, sql.ErrNoRows) {
+		return CustomRadio{}, false, nil
+	}
+	if err != nil {
+		return CustomRadio{}, false, err
+	}
+	return radio, true, nil
+}
+
+func (ss *sqliteStore) ListCustomRadios() (map[string]CustomRadio, error) {
+	rows, err := ss.db.Query(`SELECT name, url, category FROM custom_radios`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	radios := make(map[string]CustomRadio)
+	for rows.Next() {
+		var name string
+		var radio CustomRadio
+		err = rows.Scan(&name, &radio.URL, &radio.Category)
+		if err != nil {
+			return nil, err
+		}
+		radios[name] = radio
+	}
+	return radios, rows.Err()
+}
+
+func (ss *sqliteStore) SaveCustomRadio(name string, radio CustomRadio) error {
+	_, err := ss.db.Exec(`INSERT INTO custom_radios (name, url, category) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET url = excluded.url, category = excluded.category`, name, radio.URL, radio.Category)
+	return err
+}
+
+func (ss *sqliteStore) DeleteCustomRadio(name string) (bool, error) {
+	res, err := ss.db.Exec(`DELETE FROM custom_radios WHERE name = ?`, name)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (ss *sqliteStore) RenameCustomRadio(oldName, newName string) (bool, error) {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var found, taken bool
+	err = tx.QueryRow(`SELECT
+		EXISTS (SELECT 1 FROM custom_radios WHERE name = ?),
+		EXISTS (SELECT 1 FROM custom_radios WHERE name = ?)`, oldName, newName).Scan(&found, &taken)
+	if err != nil || !found {
+		return false, err
+	}
+	if taken {
+		return false, errRadioExists
+	}
+
+	_, err = tx.Exec(`UPDATE custom_radios SET name = ? WHERE name = ?`, newName, oldName)
+	if err != nil {
+		return false, err
+	}
+
+	// Users who already had newName among their favorites keep that entry.
+	_, err = tx.Exec(`UPDATE OR IGNORE favorites SET radio_name = ? WHERE radio_name = ?`, newName, oldName)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`DELETE FROM favorites WHERE radio_name = ?`, oldName)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (ss *sqliteStore) ListFavorites(userID string) ([]string, error) {
+	rows, err := ss.db.Query(`SELECT radio_name FROM favorites WHERE user_id = ? ORDER BY position`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (ss *sqliteStore) SaveFavorite(userID, radioName string) (bool, error) {
+	res, err := ss.db.Exec(`INSERT OR IGNORE INTO favorites (user_id, radio_name, position)
+		SELECT ?, ?, COALESCE(MAX(position), 0) + 1 FROM favorites WHERE user_id = ?`, userID, radioName, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (ss *sqliteStore) DeleteFavorite(userID, radioName string) (bool, error) {
+	res, err := ss.db.Exec(`DELETE FROM favorites WHERE user_id = ? AND radio_name = ?`, userID, radioName)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+const resolveTimeout = 5 * time.Second
+
+var errPrivateAddress = errors.New("the URL points to a private or local address")
+
+// blockedPrefixes are the non-public ranges that netip has no predicate for.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("fec0::/10"),       // deprecated site-local
+	netip.MustParsePrefix("::ffff:0:0:0/96"), // IPv4-translated
+}
+
+// isPublicIP reports whether ip is a public unicast address. IPv4 addresses
+// mapped into IPv6 are checked as IPv4, so ::ffff:127.0.0.1 is not public.
+func isPublicIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkStreamURL rejects URLs whose host resolves to an address that isn't
+// public, so users can't make the bot reach internal services such as cloud
+// metadata endpoints. Every address of the host must be public, since any of
+// them may be dialed. It only gives users an early answer, as the host may
+// resolve differently when it is fetched: guardedDialer checks the
+// connections themselves. settings.AllowPrivateStreams turns the check off.
+func checkStreamURL(rawURL string) error {
+	if settings.AllowPrivateStreams {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !isPublicIP(ip) {
+			return errPrivateAddress
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("could not resolve %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip) {
+			return errPrivateAddress
+		}
+	}
+	return nil
+}
+
+// guardedDialer refuses to connect to addresses that aren't public. It checks
+// the address being dialed, after DNS resolution, so a host can't pass
+// checkStreamURL and then resolve to an internal address (DNS rebinding). The
+// bot's own requests dial through guardedTransport, and ffmpeg's through the
+// stream proxy.
+var guardedDialer = &net.Dialer{
+	Timeout:   30 * time.Second,
+	KeepAlive: 30 * time.Second,
+	Control: func(network, address string, _ syscall.RawConn) error {
+		if settings.AllowPrivateStreams {
+			return nil
+		}
+
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return err
+		}
+		if !isPublicIP(addrPort.Addr()) {
+			return errPrivateAddress
+		}
+		return nil
+	},
+}
+
+// guardedTransport is used to fetch user supplied URLs. It ignores proxy
+// settings, since the dialer would only see the address of the proxy.
+var guardedTransport = func() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = guardedDialer.DialContext
+	return t
+}()
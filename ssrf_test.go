@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"1.1.1.1", true},
+		{"2606:4700:4700::1111", true},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"10.0.0.1", false},
+		{"100.64.0.1", false},
+		{"127.0.0.1", false},
+		{"127.255.255.254", false},
+		{"169.254.169.254", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"192.0.0.8", false},
+		{"192.168.1.1", false},
+		{"198.18.0.1", false},
+		{"224.0.0.1", false},
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:0:a00:1", false},
+		{"64:ff9b:1::a00:1", false},
+		{"2001:db8::1", false},
+		{"fc00::1", false},
+		{"fd12:3456::1", false},
+		{"fe80::1", false},
+		{"fec0::1", false},
+		{"ff02::1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicIP(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestCheckStreamURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		private bool
+	}{
+		{"http://8.8.8.8/stream", false},
+		{"https://[2606:4700:4700::1111]:8443/live", false},
+		{"http://127.0.0.1:8000/", true},
+		{"http://[::1]/", true},
+		{"http://[::ffff:169.254.169.254]/latest/meta-data", true},
+		{"http://10.1.2.3/", true},
+		{"http://localhost/", true},
+	}
+	for _, tt := range tests {
+		err := checkStreamURL(tt.url)
+		if got := errors.Is(err, errPrivateAddress); got != tt.private {
+			t.Errorf("checkStreamURL(%q) = %v, want private %v", tt.url, err, tt.private)
+		}
+	}
+}
+
+func TestCheckStreamURLAllowPrivate(t *testing.T) {
+	settings.AllowPrivateStreams = true
+	defer func() { settings.AllowPrivateStreams = false }()
+
+	if err := checkStreamURL("http://127.0.0.1/"); err != nil {
+		t.Errorf("checkStreamURL with private streams allowed = %v", err)
+	}
+}
+
+// shoutcastServer answers every connection like a Shoutcast v1 server, with
+// a status line net/http can't parse.
+func shoutcastServer(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				fmt.Fprintf(conn, "ICY 200 OK\r\nicy-name: Test\r\n\r\naudio for %s", req.URL.Path)
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func proxyGet(t *testing.T, proxyAddr, host, path string) string {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "GET http://%s%s HTTP/1.1\r\nHost: %[1]s\r\nProxy-Connection: keep-alive\r\n\r\n", host, path)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(resp)
+}
+
+func TestStreamProxyRelaysShoutcast(t *testing.T) {
+	settings.AllowPrivateStreams = true
+	defer func() { settings.AllowPrivateStreams = false }()
+
+	backend := shoutcastServer(t)
+	proxy := httptest.NewServer(http.HandlerFunc(serveStreamProxy))
+	defer proxy.Close()
+
+	got := proxyGet(t, proxy.Listener.Addr().String(), backend, "/live")
+	if !strings.HasPrefix(got, "ICY 200 OK\r\n") || !strings.HasSuffix(got, "audio for /live") {
+		t.Errorf("proxied response = %q", got)
+	}
+}
+
+func TestStreamProxyRefusesPrivateAddresses(t *testing.T) {
+	backend := shoutcastServer(t)
+	proxy := httptest.NewServer(http.HandlerFunc(serveStreamProxy))
+	defer proxy.Close()
+
+	got := proxyGet(t, proxy.Listener.Addr().String(), backend, "/live")
+	if !strings.HasPrefix(got, "HTTP/1.1 403 ") {
+		t.Errorf("proxied response to a loopback address = %q, want 403", got)
+	}
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %[1]s\r\n\r\n", backend)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("CONNECT to a loopback address = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestGuardedTransportRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := (&http.Client{Transport: guardedTransport}).Get(server.URL)
+	if !errors.Is(err, errPrivateAddress) {
+		t.Errorf("GET %s = %v, want %v", server.URL, err, errPrivateAddress)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// resumeDelay gives the gateway time to deliver the guilds and their
+	// voice states before playback is resumed.
+	resumeDelay = 5 * time.Second
+
+	// resumeAttempts is how often a rate limited guild is tried, waiting
+	// resumeBackoff, doubled on each attempt, when Discord doesn't say how
+	// long to wait.
+	resumeAttempts = 4
+	resumeBackoff  = 5 * time.Second
+)
+
+// PlaybackState is what a guild was playing, so it can be resumed after
+// the bot restarts.
+type PlaybackState struct {
+	VoiceChannelID string       `json:"voice_channel_id"`
+	TextChannelID  string       `json:"text_channel_id"`
+	Station        RadioStation `json:"station"`
+}
+
+var (
+	playbackStates      = make(map[string]PlaybackState)
+	playbackStatesMutex sync.RWMutex
+)
+
+// recordPlayback saves what a guild is playing.
+func recordPlayback(guildID string, state PlaybackState) {
+	playbackStatesMutex.Lock()
+	playbackStates[guildID] = state
+	playbackStatesMutex.Unlock()
+
+	savePlaybackStates()
+}
+
+// clearPlayback forgets what a guild was playing once it stopped.
+func clearPlayback(guildID string) {
+	playbackStatesMutex.Lock()
+	_, ok := playbackStates[guildID]
+	delete(playbackStates, guildID)
+	playbackStatesMutex.Unlock()
+
+	if ok {
+		savePlaybackStates()
+	}
+}
+
+// movePlayback records that the stream of a guild moved to another voice
+// channel.
+func movePlayback(guildID, voiceChannelID string) {
+	playbackStatesMutex.Lock()
+	state, ok := playbackStates[guildID]
+	if ok {
+		state.VoiceChannelID = voiceChannelID
+		playbackStates[guildID] = state
+	}
+	playbackStatesMutex.Unlock()
+
+	if ok {
+		savePlaybackStates()
+	}
+}
+
+func savePlaybackStates() {
+	playbackStatesMutex.RLock()
+	defer playbackStatesMutex.RUnlock()
+
+	data, err := json.Marshal(playbackStates)
+	if err != nil {
+		log.Println("Error marshalling playback state:", err)
+		return
+	}
+
+	err = os.WriteFile("state.json", data, 0644)
+	if err != nil {
+		log.Println("Error writing playback state to file:", err)
+	}
+}
+
+func loadPlaybackStates() {
+	data, err := os.ReadFile("state.json")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+		log.Println("Error reading playback state file:", err)
+		return
+	}
+
+	playbackStatesMutex.Lock()
+	defer playbackStatesMutex.Unlock()
+
+	err = json.Unmarshal(data, &playbackStates)
+	if err != nil {
+		log.Println("Error unmarshalling playback state:", err)
+	}
+}
+
+// resumePlayback restarts the streams that were playing when the bot shut
+// down. Guilds whose voice channel is gone or empty are skipped. Guilds are
+// rejoined by settings.ResumeConcurrency workers so a bot in many guilds
+// doesn't run into Discord's rate limits on startup.
+func resumePlayback(s *discordgo.Session) {
+	playbackStatesMutex.RLock()
+	states := make(map[string]PlaybackState, len(playbackStates))
+	for guildID, state := range playbackStates {
+		states[guildID] = state
+	}
+	playbackStatesMutex.RUnlock()
+
+	if len(states) == 0 {
+		return
+	}
+
+	time.Sleep(resumeDelay)
+	log.Printf("Resuming playback in %d guilds", len(states))
+
+	guildIDs := make(chan string)
+	go func() {
+		for guildID := range states {
+			guildIDs <- guildID
+		}
+		close(guildIDs)
+	}()
+
+	var throttle resumeThrottle
+	var resumed, handled atomic.Int64
+	var wg sync.WaitGroup
+	for range settings.ResumeConcurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for guildID := range guildIDs {
+				if resumeGuild(s, &throttle, guildID, states[guildID]) {
+					resumed.Add(1)
+				}
+				log.Printf("Auto-resume progress: %d/%d guilds", handled.Add(1), len(states))
+			}
+		}()
+	}
+	wg.Wait()
+
+	log.Printf("Resumed playback in %d of %d guilds", resumed.Load(), len(states))
+}
+
+// resumeGuild restarts the stream of a guild, retrying while Discord rate
+// limits the join. It reports whether the stream was resumed.
+func resumeGuild(s *discordgo.Session, throttle *resumeThrottle, guildID string, state PlaybackState) bool {
+	if !isVoiceChannel(s, guildID, state.VoiceChannelID) {
+		log.Printf("Not resuming playback in guild %s: voice channel is gone", guildID)
+		clearPlayback(guildID)
+		return false
+	}
+	if len(voiceListeners(s, guildID, state.VoiceChannelID)) == 0 {
+		log.Printf("Not resuming playback in guild %s: nobody is listening", guildID)
+		clearPlayback(guildID)
+		return false
+	}
+
+	for attempt := 0; ; attempt++ {
+		throttle.wait()
+
+		_, err := startStream(s, guildID, state.VoiceChannelID, state.TextChannelID, state.Station)
+		if err == nil {
+			log.Printf("Resumed %s in guild %s", state.Station.Name, guildID)
+			time.Sleep(settings.ResumeInterval)
+			return true
+		}
+
+		backoff, limited := rateLimitBackoffFor(err, attempt)
+		if !limited || attempt+1 >= resumeAttempts {
+			log.Printf("Error resuming playback in guild %s: %v", guildID, err)
+			return false
+		}
+
+		log.Printf("Rate limited resuming playback in guild %s, pausing resumes for %s", guildID, backoff)
+		throttle.pause(backoff)
+	}
+}
+
+// rateLimitBackoffFor reports whether err means Discord rate limited a
+// request, and how long to wait before the next attempt. Discord's own
+// retry delay is used when it sent one, otherwise the delay doubles with
+// each attempt.
+func rateLimitBackoffFor(err error, attempt int) (time.Duration, bool) {
+	var rateLimitErr *discordgo.RateLimitError
+	if errors.As(err, &rateLimitErr) && rateLimitErr.TooManyRequests != nil && rateLimitErr.RetryAfter > 0 {
+		return rateLimitErr.RetryAfter, true
+	}
+
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusTooManyRequests {
+		return resumeBackoff << attempt, true
+	}
+
+	return 0, false
+}
+
+// resumeThrottle holds back all resume workers after one of them was rate
+// limited.
+type resumeThrottle struct {
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+func (t *resumeThrottle) pause(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(t.pausedUntil) {
+		t.pausedUntil = until
+	}
+}
+
+func (t *resumeThrottle) wait() {
+	t.mu.Lock()
+	d := time.Until(t.pausedUntil)
+	t.mu.Unlock()
+
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
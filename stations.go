@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// streamURLs are the built-in stations by name, loaded from
+	// settings.StationsFile.
+	streamURLs      = map[string]string{}
+	streamURLsMutex sync.RWMutex
+)
+
+// builtinRadio returns the stream URL of a built-in station.
+func builtinRadio(name string) (string, bool) {
+	streamURLsMutex.RLock()
+	defer streamURLsMutex.RUnlock()
+
+	streamURL, ok := streamURLs[name]
+	return streamURL, ok
+}
+
+// builtinRadios returns a copy of the built-in stations by name.
+func builtinRadios() map[string]string {
+	streamURLsMutex.RLock()
+	defer streamURLsMutex.RUnlock()
+
+	return maps.Clone(streamURLs)
+}
+
+// readStationsFile reads a JSON object mapping station names to stream URLs.
+// Names are normalized like custom radios, and every URL must be valid for
+// the file to be accepted. A missing file holds no stations.
+func readStationsFile(path string) (map[string]string, error) {
+	var raw map[string]string
+	err := readJSONFile(path, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	stations := make(map[string]string, len(raw))
+	for name, streamURL := range raw {
+		name = normalizeRadioName(name)
+		if name == "" {
+			return nil, fmt.Errorf("station with URL %q has no name", streamURL)
+		}
+		if !isValidURL(streamURL) {
+			return nil, fmt.Errorf("station %q has an invalid URL %q", name, streamURL)
+		}
+		stations[name] = streamURL
+	}
+
+	return stations, nil
+}
+
+// loadStations replaces the built-in stations with the ones in
+// the STATIONS_FILE setting. The previous stations are kept if the file can't be
+// read. It returns the number of stations loaded.
+func loadStations() (int, error) {
+	stations, err := readStationsFile(stationsFile())
+	if err != nil {
+		return 0, err
+	}
+
+	streamURLsMutex.Lock()
+	streamURLs = stations
+	streamURLsMutex.Unlock()
+
+	return len(stations), nil
+}
+
+func handleReloadStations(s *discordgo.Session, r Responder, args []string) {
+	if !isAdmin(s, r) {
+		r.ReplyError("Only server admins can reload the stations.")
+		return
+	}
+
+	n, err := loadStations()
+	if err != nil {
+		log.Println("Error reloading stations:", err)
+		r.ReplyError(fmt.Sprintf("Could not reload %s, keeping the current stations: %v.", stationsFile(), err))
+		return
+	}
+
+	r.Reply(fmt.Sprintf("Loaded %d built-in stations.", n))
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// statsFlushInterval is how often changed stats are written to disk.
+	// Playback updates them often, so they aren't saved on every change.
+	statsFlushInterval = time.Minute
+
+	topStationsLimit = 10
+)
+
+// StationStats is how much a station has been listened to, across guilds.
+type StationStats struct {
+	Plays         int       `json:"plays"`
+	ListenSeconds int64     `json:"listen_seconds"`
+	LastPlayed    time.Time `json:"last_played"`
+}
+
+func (st StationStats) listeningTime() time.Duration {
+	return time.Duration(st.ListenSeconds) * time.Second
+}
+
+var (
+	stationStats      = make(map[string]StationStats)
+	stationStatsDirty bool
+	stationStatsMutex sync.Mutex
+)
+
+// recordStationPlay counts a station starting to play.
+func recordStationPlay(name string) {
+	stationStatsMutex.Lock()
+	defer stationStatsMutex.Unlock()
+
+	st := stationStats[name]
+	st.Plays++
+	st.LastPlayed = time.Now()
+	stationStats[name] = st
+	stationStatsDirty = true
+}
+
+// recordListening adds how long a station played once it stops.
+func recordListening(name string, d time.Duration) {
+	stationStatsMutex.Lock()
+	defer stationStatsMutex.Unlock()
+
+	st := stationStats[name]
+	st.ListenSeconds += int64(d / time.Second)
+	stationStats[name] = st
+	stationStatsDirty = true
+}
+
+// flushStats writes the stats to disk every statsFlushInterval if they
+// changed. It never returns.
+func flushStats() {
+	ticker := time.NewTicker(statsFlushInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		saveStats()
+	}
+}
+
+// saveStats writes the stats to stats.json if they changed since the last
+// save.
+func saveStats() {
+	stationStatsMutex.Lock()
+	defer stationStatsMutex.Unlock()
+
+	if !stationStatsDirty {
+		return
+	}
+
+	data, err := json.Marshal(stationStats)
+	if err != nil {
+		log.Println("Error marshalling stats:", err)
+		return
+	}
+
+	err = os.WriteFile("stats.json", data, 0644)
+	if err != nil {
+		log.Println("Error writing stats to file:", err)
+		return
+	}
+	stationStatsDirty = false
+}
+
+func loadStats() {
+	data, err := os.ReadFile("stats.json")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+		log.Println("Error reading stats file:", err)
+		return
+	}
+
+	stationStatsMutex.Lock()
+	defer stationStatsMutex.Unlock()
+
+	err = json.Unmarshal(data, &stationStats)
+	if err != nil {
+		log.Println("Error unmarshalling stats:", err)
+	}
+}
+
+// topStations returns the names of the stations listened to the longest,
+// along with their stats.
+func topStations(limit int) ([]string, map[string]StationStats) {
+	stationStatsMutex.Lock()
+	stats := make(map[string]StationStats, len(stationStats))
+	for name, st := range stationStats {
+		stats[name] = st
+	}
+	stationStatsMutex.Unlock()
+
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if c := cmp.Compare(stats[b].ListenSeconds, stats[a].ListenSeconds); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+
+	if len(names) > limit {
+		names = names[:limit]
+	}
+	return names, stats
+}
+
+// stationStatsFor looks up the stats of a station by name, ignoring case and
+// spacing.
+func stationStatsFor(name string) (string, StationStats, bool) {
+	stationStatsMutex.Lock()
+	defer stationStatsMutex.Unlock()
+
+	for stationName, st := range stationStats {
+		if normalizeRadioName(stationName) == name {
+			return stationName, st, true
+		}
+	}
+	return "", StationStats{}, false
+}
+
+// formatLastPlayed formats when a station last played, e.g. "2h5m ago".
+func formatLastPlayed(t time.Time) string {
+	return formatUptime(time.Since(t)) + " ago"
+}
+
+func handleStats(s *discordgo.Session, r Responder, args []string) {
+	if name := radioNameArg(args); name != "" {
+		stationName, st, ok := stationStatsFor(name)
+		if !ok {
+			r.ReplyError(fmt.Sprintf("No stats for %q, it hasn't been played yet.", name))
+			return
+		}
+
+		r.Reply(fmt.Sprintf("**%s**\n**Listening time:** %s\n**Plays:** %d\n**Last played:** %s",
+			stationName, formatUptime(st.listeningTime()), st.Plays, formatLastPlayed(st.LastPlayed)))
+		return
+	}
+
+	names, stats := topStations(topStationsLimit)
+	if len(names) == 0 {
+		r.Reply("Nothing has been played yet.")
+		return
+	}
+
+	lines := []string{"**Top stations by listening time:**"}
+	for i, name := range names {
+		st := stats[name]
+		lines = append(lines, fmt.Sprintf("%d. **%s**: %s over %d plays, last played %s",
+			i+1, name, formatUptime(st.listeningTime()), st.Plays, formatLastPlayed(st.LastPlayed)))
+	}
+	replyChunked(r, strings.Join(lines, "\n"))
+}
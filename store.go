@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"radio-bot/server/config"
+)
+
+// Store persists the custom radios and the favorites of each user.
+type Store interface {
+	CustomRadio(name string) (CustomRadio, bool, error)
+	ListCustomRadios() (map[string]CustomRadio, error)
+	SaveCustomRadio(name string, radio CustomRadio) error
+	// DeleteCustomRadio reports false if there was no such radio.
+	DeleteCustomRadio(name string) (bool, error)
+	// RenameCustomRadio renames a radio along with the favorites that
+	// point to it. It reports false if there was no such radio, and returns
+	// errRadioExists if newName is taken.
+	RenameCustomRadio(oldName, newName string) (bool, error)
+
+	ListFavorites(userID string) ([]string, error)
+	// SaveFavorite reports false if the radio was already a favorite.
+	SaveFavorite(userID, radioName string) (bool, error)
+	// DeleteFavorite reports false if the radio wasn't a favorite.
+	DeleteFavorite(userID, radioName string) (bool, error)
+
+	// Reload picks up changes made to the storage by hand. The data is kept
+	// unchanged if it can't be read.
+	Reload() error
+}
+
+const (
+	radiosFile    = "radios.json"
+	favoritesFile = "favorites.json"
+)
+
+var errRadioExists = errors.New("a radio with that name already exists")
+
+// store is opened in main once the settings are loaded.
+var store Store
+
+// openStore opens the store selected in the settings.
+func openStore(driver config.StoreDriver, databasePath string) (Store, error) {
+	switch driver {
+	case config.StoreJSON:
+		return newJSONStore(radiosFile, favoritesFile)
+	case config.StoreSQLite:
+		return newSQLiteStore(databasePath)
+	}
+	return nil, fmt.Errorf("unknown store %q", driver)
+}
@@ -0,0 +1,1062 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxEncodeErrors is how many frames in a row may fail to encode before the
+// stream is given up.
+const maxEncodeErrors = 10
+
+// maxReconnectDelay caps the backoff between reconnection attempts.
+const maxReconnectDelay = time.Minute
+
+// reconnectDelay is how long to wait before reconnection attempt n, counting
+// from 0: settings.ReconnectDelay doubled n times, up to maxReconnectDelay.
+func reconnectDelay(n int) time.Duration {
+	delay := settings.ReconnectDelay
+	for range n {
+		if delay >= maxReconnectDelay/2 {
+			return maxReconnectDelay
+		}
+		delay *= 2
+	}
+	return min(delay, maxReconnectDelay)
+}
+
+// joinVoice joins a voice channel for startStream, and startPlayback runs
+// the stream of the connection it made. They are variables so streams can
+// be started and replaced without a gateway or voice connection.
+var (
+	joinVoice = func(s *discordgo.Session, guildID, voiceChannelID string) (*discordgo.VoiceConnection, error) {
+		return s.ChannelVoiceJoin(guildID, voiceChannelID, false, true)
+	}
+
+	startPlayback = func(s *discordgo.Session, conn *Connection, station RadioStation) {
+		go streamAudio(s, conn, station)
+	}
+)
+
+// voiceChannelFor returns voiceChannelID, or the voice channel of the
+// command author when it is empty. It returns errNotInVoiceChannel when the
+// author is not in one, so handlers can check it before doing any work.
+func voiceChannelFor(s *discordgo.Session, r Responder, voiceChannelID string) (string, error) {
+	if voiceChannelID != "" {
+		return voiceChannelID, nil
+	}
+
+	voiceChannelID = getUserVoiceChannelID(s, r.GuildID(), r.UserID())
+	if voiceChannelID == "" {
+		return "", errNotInVoiceChannel
+	}
+
+	return voiceChannelID, nil
+}
+
+// replyNotInVoiceChannel tells the author to join a voice channel and retry.
+func replyNotInVoiceChannel(r Responder) {
+	r.ReplyError("You must be in a voice channel to play a station. Join one and run the same command again.")
+}
+
+// playRadioStream starts the station in voiceChannelID, or in the voice
+// channel of the command author when it is empty. A downloaded attachment
+// that doesn't end up playing is deleted.
+func playRadioStream(s *discordgo.Session, r Responder, station RadioStation, voiceChannelID string) {
+	started := false
+	defer func() {
+		if !started {
+			removeTempAudio(station.URL)
+		}
+	}()
+
+	voiceChannelID, err := voiceChannelFor(s, r, voiceChannelID)
+	if err != nil {
+		replyNotInVoiceChannel(r)
+		return
+	}
+
+	if err := checkFFmpeg(); err != nil {
+		log.Println("Error playing station:", err)
+		r.ReplyError("ffmpeg is not available on the server, so nothing can be played.")
+		return
+	}
+
+	if err := sourceFor(station.URL).Probe(); err != nil {
+		if errors.Is(err, errYTDLPMissing) {
+			r.ReplyError("Playing this link needs yt-dlp, which isn't installed on the bot's host.")
+			return
+		}
+		log.Println("Stream probe failed:", err)
+		r.ReplyError(fmt.Sprintf("Warning: %v. Trying to play it anyway.", err))
+	}
+
+	// Use the player this play started rather than looking it up, since a
+	// play racing this one may already have replaced it.
+	player, err := startStream(s, r.GuildID(), voiceChannelID, r.ChannelID(), station)
+	if err != nil {
+		replyJoinError(r, err)
+		return
+	}
+	started = true
+
+	messageID := r.ReplyEmbed(nowPlayingEmbed(station, player.targetVolume(), player.isMuted()))
+	if messageID != "" {
+		addPlaybackControls(s, player, r.ChannelID(), messageID)
+	}
+}
+
+// startStream joins the voice channel and starts streaming station in the
+// guild, replacing whatever was playing there. Messages about the stream are
+// sent to textChannelID. Plays in a guild are serialized, so however many
+// race, the old stream is stopped before the next joins and exactly one
+// survives. It returns the player of the connection playing station.
+func startStream(s *discordgo.Session, guildID, voiceChannelID, textChannelID string, station RadioStation) (Player, error) {
+	// Stopping the old stream and joining the channel can block for seconds,
+	// but only plays and stops in this guild wait for the lock.
+	unlock := guilds.Lock(guildID)
+	defer unlock()
+
+	// Check before stopping the old stream, which keeps playing if the bot
+	// can't use the new channel.
+	if err := checkVoicePermissions(s, voiceChannelID); err != nil {
+		return nil, err
+	}
+
+	if old, ok := guilds.Connection(guildID); ok {
+		// With crossfade on, switch stations in place so the old one can
+		// fade out instead of rejoining the channel. The queue refuses the
+		// station if the old stream is ending, and it is replaced instead.
+		if old.vc.ChannelID == voiceChannelID && crossfadeDuration(guildID) > 0 && !old.finished() && old.queue.PushFront(station) {
+			old.requestSkip()
+			return old, nil
+		}
+
+		guilds.Remove(guildID, old)
+		old.stopPlaying()
+	}
+
+	vc, err := joinVoice(s, guildID, voiceChannelID)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	conn := &Connection{
+		id:        newStreamID(),
+		vc:        vc,
+		stop:      stop,
+		done:      done,
+		skip:      make(chan struct{}, 1),
+		swap:      make(chan AudioSource),
+		queue:     NewQueue(),
+		channelID: textChannelID,
+		radioName: station.Name,
+		streamURL: station.URL,
+		startedAt: time.Now(),
+		streaming: true,
+		volume:    guildVolume(guildID),
+		normalize: settings.Normalize,
+	}
+	guilds.Set(guildID, conn)
+
+	setLastStation(guildID, station)
+	recordPlayback(guildID, PlaybackState{VoiceChannelID: voiceChannelID, TextChannelID: textChannelID, Station: station})
+
+	streamsStarted.Inc()
+	conn.notify(eventStart, nil)
+	conn.play(s, station)
+
+	updatePresence(s)
+	return conn, nil
+}
+
+// stopConnection stops conn and waits for its stream to finish. It reports
+// false if conn is no longer the active connection of its guild.
+func stopConnection(s *discordgo.Session, conn *Connection) bool {
+	guildID := conn.vc.GuildID
+
+	unlock := guilds.Lock(guildID)
+	defer unlock()
+
+	if !guilds.Remove(guildID, conn) {
+		return false
+	}
+
+	conn.stopPlaying()
+	clearPlayback(guildID)
+
+	updatePresence(s)
+	return true
+}
+
+// setSleepTimer schedules the connection to stop after d, replacing any
+// pending timer. A zero duration only cancels the pending timer. It reports
+// whether a pending timer was cancelled.
+func (c *Connection) setSleepTimer(s *discordgo.Session, d time.Duration) bool {
+	c.sleepMu.Lock()
+	defer c.sleepMu.Unlock()
+
+	cancelled := false
+	if c.sleepTimer != nil {
+		cancelled = c.sleepTimer.Stop()
+		c.sleepTimer = nil
+	}
+
+	if d > 0 {
+		c.sleepTimer = time.AfterFunc(d, func() {
+			if stopConnection(s, c) {
+				sendMessage(s, c.channelID, "Sleep timer expired, stopped playing.")
+			}
+		})
+	}
+
+	return cancelled
+}
+
+func (c *Connection) normalizeEnabled() bool {
+	c.normalizeMu.Lock()
+	defer c.normalizeMu.Unlock()
+
+	return c.normalize
+}
+
+// setNormalize toggles loudness normalization and restarts ffmpeg so the
+// change applies to the current stream. It reports whether it changed.
+func (c *Connection) setNormalize(normalize bool) bool {
+	c.normalizeMu.Lock()
+	changed := c.normalize != normalize
+	c.normalize = normalize
+	c.normalizeMu.Unlock()
+
+	if changed {
+		go func() {
+			// Finite sources carry on from where they were.
+			var start time.Duration
+			if !c.isLive() {
+				start = c.position()
+			}
+			// A stream that isn't being read picks the change up when
+			// it starts.
+			err := restartStream(c, c.currentStation().URL, start)
+			if err != nil && !errors.Is(err, errStreamStopped) && !errors.Is(err, errNotDecoding) {
+				c.logger().Println("Error restarting stream:", err)
+			}
+		}()
+	}
+
+	return changed
+}
+
+// setPaused updates the paused state of the connection and reports whether
+// it changed.
+func (c *Connection) setPaused(paused bool) bool {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+
+	if c.paused == paused {
+		return false
+	}
+
+	c.paused = paused
+	if paused {
+		c.resume = make(chan struct{})
+		c.pausedAt = time.Now()
+	} else {
+		close(c.resume)
+		c.resume = nil
+		if c.pauseTimer != nil {
+			c.pauseTimer.Stop()
+			c.pauseTimer = nil
+		}
+	}
+
+	return true
+}
+
+// play streams station, and the queue after it, until the stream ends or
+// stopPlaying is called.
+func (c *Connection) play(s *discordgo.Session, station RadioStation) {
+	startPlayback(s, c, station)
+}
+
+// stopPlaying stops the stream and waits for it to end. It must be called
+// only once, by whoever removed the connection from its guild.
+func (c *Connection) stopPlaying() {
+	close(c.stop)
+	<-c.done
+}
+
+// finished reports whether the stream has ended.
+func (c *Connection) finished() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Connection) currentRadioName() string {
+	c.stationMu.RLock()
+	defer c.stationMu.RUnlock()
+
+	return c.radioName
+}
+
+func (c *Connection) currentStation() RadioStation {
+	c.stationMu.RLock()
+	defer c.stationMu.RUnlock()
+
+	return RadioStation{Name: c.radioName, URL: c.streamURL}
+}
+
+// setStation changes the current station and forgets the track title, start
+// time and skip votes of the previous one.
+func (c *Connection) setStation(station RadioStation) {
+	c.stationMu.Lock()
+	c.radioName = station.Name
+	c.streamURL = station.URL
+	c.title = ""
+	c.startedAt = time.Now()
+	c.stationMu.Unlock()
+
+	c.resetSkipVotes()
+}
+
+// setStreamURL records the URL ffmpeg is playing for the current station,
+// after following any playlist, and whether it is a live stream.
+func (c *Connection) setStreamURL(streamURL string, live bool) {
+	c.stationMu.Lock()
+	c.streamURL = streamURL
+	c.live = live
+	c.stationMu.Unlock()
+}
+
+// isLive reports whether the current station plays endlessly, so it can't
+// be seeked.
+func (c *Connection) isLive() bool {
+	c.stationMu.RLock()
+	defer c.stationMu.RUnlock()
+
+	return c.live
+}
+
+// uptime returns how long the current station has been playing.
+func (c *Connection) uptime() time.Duration {
+	c.stationMu.RLock()
+	defer c.stationMu.RUnlock()
+
+	return time.Since(c.startedAt)
+}
+
+func (c *Connection) isPaused() bool {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+
+	return c.paused
+}
+
+func (c *Connection) currentVolume() float64 {
+	c.volumeMu.RLock()
+	defer c.volumeMu.RUnlock()
+
+	return c.volume
+}
+
+// setVolume changes the volume of the stream and remembers it for the next
+// streams in the guild. While muted, it changes the volume restored on
+// unmute instead.
+func (c *Connection) setVolume(volume float64) {
+	c.volumeMu.Lock()
+	if c.muted {
+		c.preMuteVolume = volume
+	} else {
+		c.volume = volume
+	}
+	c.volumeMu.Unlock()
+
+	setGuildVolume(c.vc.GuildID, volume)
+}
+
+// adjustVolume changes the volume by delta, keeping it between 0 and max, and
+// remembers the result for the next streams in the guild. It returns the new
+// volume. Like setVolume, it changes the restored volume while muted.
+func (c *Connection) adjustVolume(delta, max float64) float64 {
+	c.volumeMu.Lock()
+	current := &c.volume
+	if c.muted {
+		current = &c.preMuteVolume
+	}
+	// Round to whole percents so repeated steps don't drift.
+	volume := math.Round((*current+delta)*100) / 100
+	volume = math.Min(math.Max(volume, 0), max)
+	*current = volume
+	c.volumeMu.Unlock()
+
+	setGuildVolume(c.vc.GuildID, volume)
+	return volume
+}
+
+// currentTitle returns the last track title announced by the stream.
+func (c *Connection) currentTitle() string {
+	c.stationMu.RLock()
+	defer c.stationMu.RUnlock()
+
+	return c.title
+}
+
+func (c *Connection) setTitle(title string) {
+	c.stationMu.Lock()
+	c.title = title
+	c.stationMu.Unlock()
+}
+
+// isVoiceChannel reports whether channelID is a voice or stage channel of
+// the guild.
+func isVoiceChannel(s *discordgo.Session, guildID, channelID string) bool {
+	channel, err := s.State.Channel(channelID)
+	if err != nil {
+		channel, err = s.Channel(channelID)
+		if err != nil {
+			return false
+		}
+	}
+
+	return channel.GuildID == guildID && (channel.Type == discordgo.ChannelTypeGuildVoice || channel.Type == discordgo.ChannelTypeGuildStageVoice)
+}
+
+// updateBitrate sets the Opus bitrate of the connection for voiceChannelID,
+// when it starts and after it moved. The stream applies it from the next
+// frame on.
+func (c *Connection) updateBitrate(s *discordgo.Session, voiceChannelID string) {
+	bitrate := encoderBitrate(voiceChannelBitrate(s, voiceChannelID), settings.AudioBitrate)
+	if c.bitrate.Swap(int64(bitrate)) != int64(bitrate) {
+		c.logger().Debugf("Encoding at %d bps", bitrate)
+	}
+}
+
+// voiceChannelBitrate returns the bitrate of a voice channel in bits per
+// second, or 0 if it is unknown.
+func voiceChannelBitrate(s *discordgo.Session, channelID string) int {
+	channel, err := s.State.Channel(channelID)
+	if err != nil {
+		channel, err = s.Channel(channelID)
+		if err != nil {
+			return 0
+		}
+	}
+	return channel.Bitrate
+}
+
+// disconnect leaves the voice channel. Only the first call disconnects, so
+// it is safe to call from every teardown path.
+func (c *Connection) disconnect() {
+	c.disconnectOnce.Do(func() {
+		err := c.vc.Disconnect()
+		if err != nil {
+			c.logger().Println("Error disconnecting from voice channel:", err)
+		}
+	})
+}
+
+// newStreamID returns a short random ID that identifies a playback session
+// in the logs from join to disconnect.
+func newStreamID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// logger returns a log entry carrying the stream ID, guild and station of
+// the connection.
+func (c *Connection) logger() *log.Entry {
+	return log.WithFields(log.Fields{
+		"streamID": c.id,
+		"guild":    c.vc.GuildID,
+		"station":  c.currentRadioName(),
+	})
+}
+
+func getUserVoiceChannelID(s *discordgo.Session, guildID, userID string) string {
+
+	guild, err := s.State.Guild(guildID)
+	if err != nil {
+
+		guild, err = s.Guild(guildID)
+		if err != nil {
+			log.Println("Error getting guild:", err)
+			return ""
+		}
+	}
+
+	for _, vs := range guild.VoiceStates {
+		if vs.UserID == userID {
+			return vs.ChannelID
+		}
+	}
+
+	return ""
+}
+
+func streamAudio(s *discordgo.Session, conn *Connection, station RadioStation) {
+	defer removeConnection(s, conn)
+	defer close(conn.done)
+	defer conn.setSleepTimer(s, 0)
+
+	if settings.MaxStreamDuration > 0 {
+		limit := time.AfterFunc(settings.MaxStreamDuration, func() {
+			conn.logger().Println("Maximum stream duration reached")
+			if stopConnection(s, conn) {
+				sendMessage(s, conn.channelID, fmt.Sprintf("Max duration of %s reached, stopped playing.", formatUptime(settings.MaxStreamDuration)))
+			}
+		})
+		defer limit.Stop()
+	}
+
+	activeStreams.Inc()
+	defer activeStreams.Dec()
+	defer conn.disconnect()
+	defer conn.notify(eventStop, nil)
+	defer func() { removeTempAudio(station.URL) }()
+	// Closing the queue deletes the attachments still queued, and keeps a
+	// play from handing a station to the ending stream.
+	defer func() { removeQueuedTempAudio(conn.queue.Close()) }()
+
+	// finishListening adds how long the current station played to its stats,
+	// once per station.
+	listened := false
+	finishListening := func() {
+		if !listened {
+			listened = true
+			recordListening(station.Name, conn.uptime())
+		}
+	}
+	defer finishListening()
+	recordStationPlay(station.Name)
+
+	vc := conn.vc
+
+	conn.updateBitrate(s, vc.ChannelID)
+	opusEncoder, err := newEncoder(int(conn.bitrate.Load()))
+	if err != nil {
+		conn.logger().Println("Error creating Opus encoder:", err)
+		streamErrors.Inc()
+		conn.notify(eventError, err)
+		sendMessage(s, conn.channelID, "Couldn't set up audio encoding on the server, so nothing can be played.")
+		return
+	}
+
+	vc.Speaking(true)
+	defer vc.Speaking(false)
+
+	// fadeFrom is the source of a skipped station, still running so the
+	// next one can crossfade from it.
+	var fadeFrom AudioSource
+	defer func() {
+		if fadeFrom != nil {
+			fadeFrom.Close()
+		}
+	}()
+
+	attempts := 0
+	announced := false
+	// voiceRecovered is set after rejoining the voice channel, so a
+	// connection that drops again before any audio went out is given up.
+	voiceRecovered := false
+	// passthrough is cleared once the station turned out not to be suited
+	// for Opus passthrough, so reconnects go straight to re-encoding.
+	passthrough := true
+	for {
+		if settings.TTSAnnounce && !announced {
+			announced = true
+			err := announce(conn, opusEncoder, "Now playing "+station.Name)
+			if errors.Is(err, errStreamStopped) {
+				conn.logger().Println("Stream stopped by user")
+				return
+			}
+			if err != nil {
+				conn.logger().Println("Error announcing station:", err)
+			}
+		}
+
+		played := false
+		source := sourceFor(station.URL)
+		streamURL, err := source.StreamURL()
+		stopWatch := conn.watchRecovery(s, station)
+		if err == nil {
+			conn.setStreamURL(streamURL, source.Live())
+			usePassthrough := passthrough && fadeFrom == nil && canPassthrough(conn, streamURL)
+			if usePassthrough {
+				played, err = playOpusStream(conn, streamURL)
+				if errors.Is(err, errNoPassthrough) {
+					conn.logger().Println("Re-encoding stream:", err)
+					usePassthrough = false
+				}
+			}
+			if !usePassthrough {
+				passthrough = false
+				var encoded bool
+				encoded, fadeFrom, err = playStream(conn, opusEncoder, streamURL, fadeFrom)
+				played = played || encoded
+			}
+		} else if fadeFrom != nil {
+			fadeFrom.Close()
+			fadeFrom = nil
+		}
+		stopWatch()
+		switch {
+		case errors.Is(err, errStreamStopped):
+			conn.logger().Println("Stream stopped by user")
+			return
+		case errors.Is(err, errStreamSkipped):
+			conn.logger().Println("Stream skipped")
+		case errors.Is(err, errFFmpegMissing):
+			conn.logger().Println("Stream stopped due to error:", err)
+			streamErrors.Inc()
+			conn.notify(eventError, err)
+			sendMessage(s, conn.channelID, "ffmpeg is not available on the server, so nothing can be played.")
+			return
+		case errors.Is(err, errEncoding):
+			conn.logger().Println("Stream stopped due to error:", err)
+			streamErrors.Inc()
+			conn.notify(eventError, err)
+			sendMessage(s, conn.channelID, fmt.Sprintf("Stopped playing %s, the audio couldn't be encoded.", station.Name))
+			return
+		case errors.Is(err, errVoiceNotReady):
+			// The stream itself is fine, so it carries on once the voice
+			// connection is back, without using up its reconnect attempts.
+			streamErrors.Inc()
+			conn.notify(eventError, err)
+			if played {
+				voiceRecovered = false
+			}
+			if !voiceRecovered {
+				conn.logger().Println("Voice connection dropped, recovering")
+				err = conn.recoverVoice(s)
+				if errors.Is(err, errStreamStopped) {
+					conn.logger().Println("Stream stopped by user")
+					return
+				}
+				if err == nil {
+					conn.logger().Println("Voice connection recovered")
+					vc.Speaking(true)
+					voiceRecovered = true
+					continue
+				}
+			}
+			conn.logger().Println("Stream stopped due to error:", err)
+			sendMessage(s, conn.channelID, fmt.Sprintf("Lost the voice connection and couldn't rejoin, stopped playing %s.", station.Name))
+			return
+		case !source.Live() && errors.Is(err, io.EOF):
+			if conn.loopMode() == loopTrack {
+				conn.logger().Println("Stream finished, playing it again")
+				attempts = 0
+				continue
+			}
+			conn.logger().Println("Stream finished")
+			if len(conn.queue.Items()) == 0 && conn.loopMode() != loopQueue {
+				sendMessage(s, conn.channelID, fmt.Sprintf("The stream for %s ended.", station.Name))
+			}
+		default:
+			// The stream dropped on its own, so try to reconnect to the same
+			// URL with exponential backoff before moving on.
+			streamErrors.Inc()
+			conn.notify(eventError, err)
+			if played {
+				attempts = 0
+			}
+			if attempts >= settings.ReconnectAttempts {
+				conn.logger().Println("Stream stopped due to error:", err)
+				message := fmt.Sprintf("Lost the stream for %s after %d reconnection attempts (stream %s).", station.Name, attempts, conn.id)
+				var ffmpegErr *ffmpegError
+				if errors.As(err, &ffmpegErr) && ffmpegErr.output != "" {
+					message += fmt.Sprintf("\nffmpeg reported:\n```\n%s\n```", ffmpegErr.output)
+				}
+				sendMessage(s, conn.channelID, message)
+				break
+			}
+
+			delay := reconnectDelay(attempts)
+			attempts++
+			streamReconnects.Inc()
+			conn.notify(eventReconnect, err)
+			conn.logger().Printf("Stream interrupted (%v), reconnecting in %s (attempt %d/%d)", err, delay, attempts, settings.ReconnectAttempts)
+			conn.noteReconnect(s, station)
+
+			select {
+			case <-conn.stop:
+				conn.logger().Println("Stream stopped by user")
+				return
+			case <-conn.skip:
+				conn.logger().Println("Stream skipped")
+			case <-time.After(delay):
+				continue
+			}
+		}
+
+		// Looping the queue puts the station back at the end, so it plays
+		// again once everything queued after it has.
+		looped := conn.loopMode() == loopQueue
+		if looped {
+			conn.queue.Push(station)
+		}
+
+		attempts = 0
+		finishListening()
+		next, ok := conn.nextInQueue()
+		if !ok {
+			select {
+			case <-conn.stop:
+			default:
+				sendMessage(s, conn.channelID, "Nothing else was queued, left the voice channel.")
+			}
+			return
+		}
+		if !looped {
+			removeTempAudio(station.URL)
+		}
+		station = next
+		announced = false
+		passthrough = true
+		conn.resetReconnects()
+		conn.setStation(station)
+		listened = false
+		recordStationPlay(station.Name)
+		conn.notify(eventStart, nil)
+		setLastStation(conn.vc.GuildID, station)
+		recordPlayback(conn.vc.GuildID, PlaybackState{VoiceChannelID: conn.vc.ChannelID, TextChannelID: conn.channelID, Station: station})
+		updatePresence(s)
+	}
+}
+
+// playStream decodes streamURL and sends the encoded audio to
+// the voice connection until the stream ends, fails, is skipped or stopped.
+// It reports whether any audio was sent before returning.
+//
+// When fadeFrom is set, it is the still running source of the previous
+// station, which keeps playing until the new one is ready and then fades
+// out. playStream closes it. On a skip with crossfade enabled, the current
+// source is returned open instead of closed, for the next call to fade from.
+func playStream(conn *Connection, opusEncoder Encoder, streamURL string, fadeFrom AudioSource) (bool, AudioSource, error) {
+	vc := conn.vc
+
+	// Discard a skip requested while nothing was playing.
+	select {
+	case <-conn.skip:
+	default:
+	}
+
+	conn.logger().Println("Starting audio stream...")
+	conn.setPosition(0)
+
+	source, err := newAudioSource(streamURL, conn.normalizeEnabled(), 0)
+	if err != nil {
+		if fadeFrom != nil {
+			fadeFrom.Close()
+		}
+		return false, nil, err
+	}
+
+	// The reader replaces source when restartStream hands over a new ffmpeg,
+	// so it is guarded to let the teardown below close whichever is current.
+	var sourceMu sync.Mutex
+	swap := func(next AudioSource) {
+		if next.sourceURL() != streamURL {
+			next.Close()
+			return
+		}
+
+		sourceMu.Lock()
+		previous := source
+		source = next
+		sourceMu.Unlock()
+
+		previous.Close()
+	}
+
+	errChan := make(chan error, 1)
+	played := false
+	quit := make(chan struct{})
+	finished := make(chan struct{})
+	readerDone := make(chan struct{})
+
+	// The reader keeps a buffer of decoded frames ahead of the sender, so
+	// brief stalls of the source don't interrupt playback. frames is closed
+	// after readErr is set when the source ends.
+	frames := make(chan []int16, settings.AudioBufferFrames)
+	var readErr error
+
+	go watchStreamTitle(streamURL, quit, conn.setTitle)
+
+	go func() {
+		defer close(readerDone)
+		defer close(frames)
+
+		if fadeFrom != nil {
+			err := fadeInto(fadeFrom, source, crossfadeDuration(vc.GuildID), func(pcm []int16) bool {
+				select {
+				case <-quit:
+					return false
+				case frames <- pcm:
+					return true
+				}
+			})
+			fadeFrom.Close()
+			if errors.Is(err, errStreamStopped) {
+				return
+			}
+			if err != nil {
+				readErr = err
+				return
+			}
+		}
+
+		conn.decoding.Store(true)
+		defer conn.decoding.Store(false)
+
+		for {
+			sourceMu.Lock()
+			current := source
+			sourceMu.Unlock()
+
+			pcm := make([]int16, frameSize*channels)
+			err := current.readFrame(pcm)
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				// The output ended partway through a frame. Play the padded
+				// tail, then end as if the frame had been complete.
+				select {
+				case <-quit:
+					return
+				case frames <- pcm:
+				}
+				err = io.EOF
+			}
+			if err != nil {
+				select {
+				case <-quit:
+				default:
+					if err != io.EOF {
+						conn.logger().Println("Error reading stream data: ", err)
+					}
+				}
+				readErr = err
+				return
+			}
+
+			select {
+			case <-quit:
+				return
+			case next := <-conn.swap:
+				// Drop the frame of the replaced source, and the ones
+				// buffered from it, so none of it plays after the switch.
+				swap(next)
+				for len(frames) > 0 {
+					select {
+					case <-frames:
+					default:
+					}
+				}
+			case frames <- pcm:
+			}
+		}
+	}()
+
+	// sendSilence sends one frame of silence, which keeps the voice session
+	// alive while there is no audio to send.
+	sendSilence := func() {
+		if !vc.Ready || vc.OpusSend == nil {
+			return
+		}
+		select {
+		case vc.OpusSend <- silenceFrame:
+		case <-quit:
+		}
+	}
+
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(frameDuration)
+		defer ticker.Stop()
+		encodeErrors := 0
+		bitrate := conn.bitrate.Load()
+
+		for {
+			select {
+			case <-quit:
+				return
+			default:
+			}
+
+			conn.pauseMu.Lock()
+			resume := conn.resume
+			conn.pauseMu.Unlock()
+			if resume != nil {
+				// Stop pulling frames so no stream data is discarded while
+				// paused. The reader blocks once the buffer is full.
+				select {
+				case <-quit:
+					return
+				case <-resume:
+				case <-ticker.C:
+					sendSilence()
+				}
+				continue
+			}
+
+			var pcm []int16
+			ok := true
+			select {
+			case pcm, ok = <-frames:
+			default:
+				if played {
+					bufferUnderruns.Inc()
+					conn.logger().Debug("Audio buffer underrun")
+				}
+			waiting:
+				for {
+					select {
+					case <-quit:
+						return
+					case pcm, ok = <-frames:
+						break waiting
+					case <-ticker.C:
+						sendSilence()
+					}
+				}
+			}
+			if !ok {
+				errChan <- readErr
+				return
+			}
+
+			applyGain(pcm, conn.currentVolume())
+
+			// Only the sender uses the encoder, so a move applies the
+			// bitrate of the new channel here.
+			if next := conn.bitrate.Load(); next != bitrate {
+				bitrate = next
+				opusEncoder.SetBitrate(int(bitrate))
+			}
+
+			// A frame that fails to encode is dropped, but an encoder that
+			// keeps failing won't recover, so the stream ends.
+			opusData, err := opusEncoder.Encode(pcm, frameSize, maxBytes)
+			if err != nil {
+				encodeErrors++
+				conn.logger().Println("Error encoding PCM to Opus: ", err)
+				if encodeErrors >= maxEncodeErrors {
+					errChan <- fmt.Errorf("%w: %v", errEncoding, err)
+					return
+				}
+				continue
+			}
+			encodeErrors = 0
+
+			// Send on the 20ms ticker instead of as fast as frames arrive. The
+			// ticker drops ticks when the sender falls behind, so it catches
+			// up by at most one frame instead of bursting.
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+			}
+
+			if !vc.Ready || vc.OpusSend == nil {
+				conn.logger().Println("Discord voice connection is not ready")
+				errChan <- errVoiceNotReady
+				return
+			}
+			select {
+			case vc.OpusSend <- opusData:
+			case <-quit:
+				return
+			}
+			bytesStreamed.Add(float64(len(opusData)))
+			conn.playedFrames.Add(1)
+			played = true
+		}
+	}()
+
+	conn.logger().Println("Streaming started")
+
+	select {
+	case <-conn.stop:
+		err = errStreamStopped
+	case <-conn.skip:
+		err = errStreamSkipped
+	case err = <-errChan:
+	}
+
+	// Keep the source running for the next station to fade from, unless
+	// nothing is queued to fade into.
+	keep := errors.Is(err, errStreamSkipped) && crossfadeDuration(vc.GuildID) > 0 && len(conn.queue.Items()) > 0
+
+	close(quit)
+	if !keep {
+		sourceMu.Lock()
+		source.Close()
+		sourceMu.Unlock()
+	}
+	<-finished
+	<-readerDone
+
+	if keep {
+		return played, source, err
+	}
+
+	// The reader may have swapped in another process before it saw quit.
+	source.Close()
+
+	// ffmpeg failing to open a stream just ends its output, so explain
+	// the failure with what it logged.
+	if !played && errors.Is(err, io.EOF) {
+		if exitErr := source.exitError(); exitErr != nil {
+			err = exitErr
+		}
+	}
+
+	return played, nil, err
+}
+
+// nextInQueue returns the next queued station, waiting up to idleTimeout for
+// one to be enqueued when the queue is empty.
+func (c *Connection) nextInQueue() (RadioStation, bool) {
+	timer := time.NewTimer(idleTimeout)
+	defer timer.Stop()
+
+	for {
+		if station, ok := c.queue.Pop(); ok {
+			return station, true
+		}
+
+		select {
+		case <-c.stop:
+			return RadioStation{}, false
+		case <-c.queue.notify:
+		case <-timer.C:
+			c.logger().Println("Queue is empty, disconnecting after idle timeout")
+			return RadioStation{}, false
+		}
+	}
+}
+
+// removeConnection drops conn from its guild if it is still the active
+// connection there, then refreshes the bot presence.
+func removeConnection(s *discordgo.Session, conn *Connection) {
+	if guilds.Remove(conn.vc.GuildID, conn) {
+		clearPlayback(conn.vc.GuildID)
+	}
+
+	updatePresence(s)
+}
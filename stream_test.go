@@ -0,0 +1,246 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// testSession returns a session whose state has the bot owning each guild,
+// with a voice channel "voice-<guild ID>" in it, so checkVoicePermissions
+// passes without calling Discord.
+func testSession(t *testing.T, guildIDs ...string) *discordgo.Session {
+	t.Helper()
+
+	state := discordgo.NewState()
+	state.User = &discordgo.User{ID: "bot"}
+	for _, guildID := range guildIDs {
+		err := state.GuildAdd(&discordgo.Guild{
+			ID:      guildID,
+			OwnerID: "bot",
+			Channels: []*discordgo.Channel{
+				{ID: "voice-" + guildID, GuildID: guildID, Type: discordgo.ChannelTypeGuildVoice},
+			},
+			Members: []*discordgo.Member{
+				{GuildID: guildID, User: state.User},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &discordgo.Session{State: state}
+}
+
+// fakePlayback replaces joining voice channels and running streams, and
+// counts the streams running, which stand for ffmpeg processes.
+type fakePlayback struct {
+	// join, if set, is called before each voice join returns.
+	join func(guildID string)
+
+	mu      sync.Mutex
+	running int
+}
+
+func stubPlayback(t *testing.T) *fakePlayback {
+	t.Helper()
+
+	// startStream saves the guild settings and playback state to the
+	// working directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakePlayback{}
+	previousGuilds, previousJoin, previousStart := guilds, joinVoice, startPlayback
+	guilds = NewGuildManager()
+	joinVoice = func(s *discordgo.Session, guildID, voiceChannelID string) (*discordgo.VoiceConnection, error) {
+		if fake.join != nil {
+			fake.join(guildID)
+		}
+		return &discordgo.VoiceConnection{GuildID: guildID, ChannelID: voiceChannelID, Ready: true}, nil
+	}
+	startPlayback = func(s *discordgo.Session, conn *Connection, station RadioStation) {
+		fake.mu.Lock()
+		fake.running++
+		fake.mu.Unlock()
+
+		go func() {
+			<-conn.stop
+			fake.mu.Lock()
+			fake.running--
+			fake.mu.Unlock()
+			close(conn.done)
+		}()
+	}
+	t.Cleanup(func() {
+		guilds, joinVoice, startPlayback = previousGuilds, previousJoin, previousStart
+		os.Chdir(wd)
+	})
+	return fake
+}
+
+func (fake *fakePlayback) streamsRunning() int {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return fake.running
+}
+
+func TestStartStreamOtherGuildsDontWait(t *testing.T) {
+	s := testSession(t, "guild-a", "guild-b")
+	fake := stubPlayback(t)
+
+	joining := make(chan struct{})
+	release := make(chan struct{})
+	fake.join = func(guildID string) {
+		if guildID == "guild-a" {
+			close(joining)
+			<-release
+		}
+	}
+
+	started := make(chan error, 1)
+	go func() {
+		_, err := startStream(s, "guild-a", "voice-guild-a", "text", RadioStation{Name: "A", URL: "http://a.example.com/"})
+		started <- err
+	}()
+	<-joining
+
+	// The join in guild-a is still blocked, which must not hold up guild-b.
+	done := make(chan error, 1)
+	go func() {
+		_, err := startStream(s, "guild-b", "voice-guild-b", "text", RadioStation{Name: "B", URL: "http://b.example.com/"})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("startStream in guild-b = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("startStream in guild-b waited for the voice join in guild-a")
+	}
+
+	close(release)
+	if err := <-started; err != nil {
+		t.Fatalf("startStream in guild-a = %v", err)
+	}
+	for _, guildID := range []string{"guild-a", "guild-b"} {
+		if _, ok := guilds.Connection(guildID); !ok {
+			t.Errorf("%s has no connection", guildID)
+		}
+	}
+	if got := fake.streamsRunning(); got != 2 {
+		t.Errorf("%d streams running, want 2", got)
+	}
+}
+
+func TestStartStreamConcurrentPlaysInGuild(t *testing.T) {
+	const plays = 5
+
+	s := testSession(t, "guild")
+	fake := stubPlayback(t)
+	// Joining takes a while, so the plays overlap.
+	fake.join = func(string) { time.Sleep(10 * time.Millisecond) }
+
+	var wg sync.WaitGroup
+	conns := make([]Player, plays)
+	for i := range plays {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			conn, err := startStream(s, "guild", "voice-guild", "text", RadioStation{Name: "Radio", URL: "http://radio.example.com/"})
+			if err != nil {
+				t.Errorf("startStream = %v", err)
+			}
+			conns[i] = conn
+		}()
+	}
+	wg.Wait()
+
+	live, ok := guilds.Connection("guild")
+	if !ok {
+		t.Fatal("the guild has no connection after the plays")
+	}
+	for i, conn := range conns {
+		if conn != Player(live) && !conn.finished() {
+			t.Errorf("the connection of play %d was replaced but is still playing", i)
+		}
+	}
+	if live.finished() {
+		t.Error("the surviving connection has stopped")
+	}
+	if got := len(guilds.Connections()); got != 1 {
+		t.Errorf("%d connections, want 1", got)
+	}
+	if got := fake.streamsRunning(); got != 1 {
+		t.Errorf("%d streams running, want 1", got)
+	}
+}
+
+func TestPlayRadioStream(t *testing.T) {
+	s := testSession(t, "guild")
+	stubPlayback(t)
+	stubLookPath(t, settings.FFmpegPath)
+	path := filepath.Join(t.TempDir(), "song.mp3")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &recordingResponder{guildID: "guild", userID: "user", channelID: "text"}
+	playRadioStream(s, r, RadioStation{Name: "song.mp3", URL: path}, "voice-guild")
+	if len(r.replies) != 1 || r.replies[0].embed == nil {
+		t.Fatalf("replies = %+v, want the now playing embed", r.replies)
+	}
+
+	live, ok := guilds.Connection("guild")
+	if !ok {
+		t.Fatal("the guild has no connection after the play")
+	}
+	if got := live.currentStation(); got.URL != path {
+		t.Errorf("playing %q, want %q", got.URL, path)
+	}
+	if live.finished() {
+		t.Error("the connection has stopped")
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	previous := settings.ReconnectDelay
+	settings.ReconnectDelay = time.Second
+	t.Cleanup(func() { settings.ReconnectDelay = previous })
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{5, 32 * time.Second},
+		{6, maxReconnectDelay},
+		// Shifting the delay this far would overflow.
+		{40, maxReconnectDelay},
+		{100, maxReconnectDelay},
+	}
+	for _, tt := range tests {
+		if got := reconnectDelay(tt.attempt); got != tt.want {
+			t.Errorf("reconnectDelay(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+
+	// A configured delay over the cap is capped too.
+	settings.ReconnectDelay = 2 * time.Minute
+	if got := reconnectDelay(0); got != maxReconnectDelay {
+		t.Errorf("reconnectDelay(0) of a 2m delay = %s, want %s", got, maxReconnectDelay)
+	}
+}
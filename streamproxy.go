@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// streamProxyURL is the address of the proxy ffmpeg reads HTTP streams
+// through, or empty when private streams are allowed and ffmpeg connects
+// directly.
+var streamProxyURL string
+
+// startStreamProxy serves the proxy ffmpeg is pointed at with -http_proxy.
+// ffmpeg resolves hosts, follows redirects and fetches HLS segments on its
+// own, so checkStreamURL can't vet the connections it makes. Sending them
+// through the proxy has guardedDialer check the address of every one of
+// them after DNS resolution. The proxy only listens on loopback.
+func startStreamProxy() error {
+	if settings.AllowPrivateStreams {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	streamProxyURL = "http://" + ln.Addr().String()
+
+	server := &http.Server{
+		Handler:           http.HandlerFunc(serveStreamProxy),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		err := server.Serve(ln)
+		log.Println("Stream proxy stopped:", err)
+	}()
+	return nil
+}
+
+// serveStreamProxy connects to the host a request is for and relays the
+// connection as it is from there on. HTTPS streams ask for a tunnel with
+// CONNECT. Plain HTTP requests are relayed without being parsed by net/http,
+// since Shoutcast servers answer "ICY 200 OK", which it rejects. ffmpeg only
+// reuses a connection for requests to the same host, so relaying the rest
+// of it to that host is safe.
+func serveStreamProxy(w http.ResponseWriter, req *http.Request) {
+	// The connection is relayed or refused, never reused for another
+	// request.
+	w.Header().Set("Connection", "close")
+
+	address := req.Host
+	if req.Method != http.MethodConnect {
+		if req.URL.Scheme != "http" || req.URL.Host == "" {
+			http.Error(w, "only absolute http URLs can be proxied", http.StatusBadRequest)
+			return
+		}
+		address = req.URL.Host
+		if req.URL.Port() == "" {
+			address = net.JoinHostPort(req.URL.Hostname(), "80")
+		}
+	}
+
+	upstream, err := guardedDialer.DialContext(req.Context(), "tcp", address)
+	if err != nil {
+		log.WithField("address", address).Debug("Stream proxy refused connection: ", err)
+		status := http.StatusBadGateway
+		if errors.Is(err, errPrivateAddress) {
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	defer upstream.Close()
+
+	if req.Method != http.MethodConnect {
+		out := req.Clone(req.Context())
+		out.Header.Del("Proxy-Connection")
+		out.Header.Del("Proxy-Authorization")
+		// Written in origin form, as the server expects it.
+		if err := out.Write(upstream); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	client, buffered, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		log.Println("Error taking over stream proxy connection:", err)
+		return
+	}
+	defer client.Close()
+
+	if req.Method == http.MethodConnect {
+		_, err = io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n")
+		if err != nil {
+			return
+		}
+	}
+
+	relay(client, buffered.Reader, upstream)
+}
+
+// relay copies between the client and upstream until either side closes.
+// Bytes the client sent after its request are already in buffered.
+func relay(client net.Conn, buffered *bufio.Reader, upstream net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		io.Copy(upstream, buffered)
+		if tcp, ok := upstream.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+	}()
+
+	io.Copy(client, upstream)
+	client.Close()
+	upstream.Close()
+	wg.Wait()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// suggestCacheTTL is how long the lists of popular stations are reused. They
+// change slowly, but briefly caching them is enough to spare the API.
+const suggestCacheTTL = 10 * time.Minute
+
+var suggestionsCache = newSearchCache(suggestCacheTTL, 50)
+
+// countryQuery filters by country code for two letter countries, and by
+// country name otherwise.
+func countryQuery(country string) SearchQuery {
+	query := SearchQuery{Filters: map[string]string{}}
+	if len(country) == 2 {
+		query.Filters["countrycode"] = strings.ToUpper(country)
+	} else {
+		query.Filters["country"] = country
+	}
+	return query
+}
+
+// topClickStations returns the most played stations on radio-browser.
+func topClickStations(ctx context.Context) ([]RadioStation, error) {
+	params := url.Values{}
+	params.Set("limit", strconv.Itoa(searchLimit))
+	params.Set("hidebroken", "true")
+
+	resp, err := radioBrowserGet(ctx, "/json/stations/topclick", params)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeStations(resp.Body)
+}
+
+// suggestStations returns popular stations, from country when it is set.
+func suggestStations(ctx context.Context, country string) ([]RadioStation, error) {
+	// Without a country the query is empty, which no search uses.
+	query := SearchQuery{}
+	if country != "" {
+		query = countryQuery(country)
+	}
+
+	if stations, ok := suggestionsCache.get(query); ok {
+		searchCacheHits.Inc()
+		return stations, nil
+	}
+
+	var stations []RadioStation
+	var err error
+	if country == "" {
+		stations, err = topClickStations(ctx)
+	} else {
+		stations, err = searchRadioStations(ctx, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	suggestionsCache.put(query, stations)
+	return stations, nil
+}
+
+// handleSuggest lists popular stations, from the given country or the one
+// set for the guild, to play with !playstation like search results.
+func handleSuggest(s *discordgo.Session, r Responder, args []string) {
+	country := strings.Join(args, " ")
+	if country == "" {
+		country = guildCountry(r.GuildID())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), searchTimeout)
+	defer cancel()
+
+	stations, err := suggestStations(ctx, country)
+	if err != nil {
+		replySearchError(r, err)
+		log.Println("Error suggesting radio stations:", err)
+		return
+	}
+
+	if len(stations) == 0 {
+		r.Reply(fmt.Sprintf("No radio stations found for %s.", country))
+		return
+	}
+
+	sr := storeSearchResults(r.UserID(), stations)
+	embed := searchResultsEmbed(sr, commandPrefix(r.GuildID()))
+	embed.Title = "Popular stations"
+	if country != "" {
+		embed.Title += " in " + country
+	}
+	r.ReplyEmbed(embed)
+}
+
+func handleSetCountry(s *discordgo.Session, r Responder, args []string) {
+	if len(args) < 1 {
+		r.ReplyError(fmt.Sprintf("Usage: `%ssetcountry <country|none>`", commandPrefix(r.GuildID())))
+		return
+	}
+
+	country := strings.Join(args, " ")
+	if strings.EqualFold(country, "none") {
+		country = resetValue
+	}
+	if !changeGuildSetting(s, r, "country", country) {
+		return
+	}
+
+	if country = guildCountry(r.GuildID()); country == "" {
+		r.Reply("Suggestions now show popular stations from everywhere.")
+		return
+	}
+	r.Reply(fmt.Sprintf("Suggestions now show popular stations in %s.", country))
+}
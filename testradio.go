@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// testRadioDuration is how much audio !testradio plays, and
+	// testRadioTimeout how long the whole test may take.
+	testRadioDuration = 5 * time.Second
+	testRadioTimeout  = 20 * time.Second
+)
+
+var errTestTimedOut = errors.New("timed out")
+
+// testStream plays streamURL in vc for testRadioDuration and returns how many
+// frames it sent. It gives up after testRadioTimeout.
+func testStream(s *discordgo.Session, vc *discordgo.VoiceConnection, streamURL string) (int, error) {
+	encoder, err := newEncoder(encoderBitrate(voiceChannelBitrate(s, vc.ChannelID), settings.AudioBitrate))
+	if err != nil {
+		return 0, err
+	}
+
+	source, err := newAudioSource(streamURL, false, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	// Closing the source also ends a read blocked on a stalled stream.
+	expired := make(chan struct{})
+	timer := time.AfterFunc(testRadioTimeout, func() {
+		close(expired)
+		source.Close()
+	})
+	defer timer.Stop()
+
+	vc.Speaking(true)
+	defer vc.Speaking(false)
+
+	ticker := time.NewTicker(frameDuration)
+	defer ticker.Stop()
+
+	frames := 0
+	for frames < int(testRadioDuration/frameDuration) {
+		pcm := make([]int16, frameSize*channels)
+		err := source.readFrame(pcm)
+		if err != nil {
+			select {
+			case <-expired:
+				return frames, errTestTimedOut
+			default:
+			}
+			if exitErr := source.exitError(); exitErr != nil {
+				return frames, exitErr
+			}
+			return frames, fmt.Errorf("the stream ended: %w", err)
+		}
+
+		opusData, err := encoder.Encode(pcm, frameSize, maxBytes)
+		if err != nil {
+			return frames, err
+		}
+
+		<-ticker.C
+		if !vc.Ready || vc.OpusSend == nil {
+			return frames, errVoiceNotReady
+		}
+		select {
+		case vc.OpusSend <- opusData:
+		case <-expired:
+			return frames, errTestTimedOut
+		}
+		frames++
+	}
+
+	return frames, nil
+}
+
+// handleTestRadio plays a URL for a few seconds in the owner's voice channel
+// and reports whether it produced audio, without saving it anywhere.
+func handleTestRadio(s *discordgo.Session, r Responder, args []string) {
+	if !isOwner(r) {
+		r.ReplyError("This command is only available to the bot owner.")
+		return
+	}
+
+	if len(args) < 1 || !isValidURL(args[0]) {
+		r.ReplyError(fmt.Sprintf("Usage: `%stestradio <url>`", commandPrefix(r.GuildID())))
+		return
+	}
+	testURL := args[0]
+
+	voiceChannelID, err := voiceChannelFor(s, r, "")
+	if err != nil {
+		replyNotInVoiceChannel(r)
+		return
+	}
+
+	// Hold the guild so no stream starts while the test uses the channel.
+	unlock := guilds.Lock(r.GuildID())
+	defer unlock()
+
+	if _, ok := guilds.Connection(r.GuildID()); ok {
+		r.ReplyError("Something is already playing here. Stop it before testing a station.")
+		return
+	}
+
+	streamURL, err := sourceFor(testURL).StreamURL()
+	if err != nil {
+		r.ReplyError(fmt.Sprintf("Test of <%s> failed, the stream couldn't be resolved: %v", testURL, err))
+		return
+	}
+
+	if err := checkVoicePermissions(s, voiceChannelID); err != nil {
+		replyJoinError(r, err)
+		return
+	}
+
+	vc, err := s.ChannelVoiceJoin(r.GuildID(), voiceChannelID, false, true)
+	if err != nil {
+		replyJoinError(r, err)
+		return
+	}
+	defer vc.Disconnect()
+
+	r.Reply(fmt.Sprintf("Testing <%s> for %s...", testURL, testRadioDuration))
+	started := time.Now()
+	frames, err := testStream(s, vc, streamURL)
+	played := time.Duration(frames) * frameDuration
+
+	if err != nil {
+		var ffmpegErr *ffmpegError
+		if errors.As(err, &ffmpegErr) {
+			err = ffmpegErr.err
+		}
+		message := fmt.Sprintf("Test of <%s> failed after %s of audio: %v", testURL, played, err)
+		if ffmpegErr != nil && ffmpegErr.output != "" {
+			message += fmt.Sprintf("\nffmpeg reported:\n```\n%s\n```", ffmpegErr.output)
+		}
+		r.ReplyError(message)
+		return
+	}
+
+	r.Reply(fmt.Sprintf("Test of <%s> passed: %d frames (%s of audio) in %s.", testURL, frames, played, time.Since(started).Round(100*time.Millisecond)))
+}
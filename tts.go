@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+)
+
+// announceTimeout bounds how long rendering and playing an announcement may
+// take, so a hung TTS engine can't hold up the stream.
+const announceTimeout = 15 * time.Second
+
+// announce speaks text in the voice channel through the same Opus path as
+// the stream. It returns errStreamStopped if the connection is stopped
+// while speaking.
+func announce(conn *Connection, opusEncoder Encoder, text string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), announceTimeout)
+	defer cancel()
+
+	wav, err := exec.CommandContext(ctx, settings.TTSCommand, "--stdout", text).Output()
+	if err != nil {
+		return fmt.Errorf("error rendering announcement: %w", err)
+	}
+
+	decoder := exec.CommandContext(ctx, settings.FFmpegPath, ffmpegArgs("pipe:0", false, 0)...)
+	decoder.Stdin = bytes.NewReader(wav)
+	pcmData, err := decoder.Output()
+	if err != nil {
+		return fmt.Errorf("error decoding announcement: %w", err)
+	}
+
+	vc := conn.vc
+	reader := bytes.NewReader(pcmData)
+	for {
+		pcm := make([]int16, frameSize*channels)
+		readErr := readPCMFrame(reader, pcm)
+		if readErr == io.EOF {
+			return nil
+		}
+
+		applyGain(pcm, conn.currentVolume())
+
+		opusData, err := opusEncoder.Encode(pcm, frameSize, maxBytes)
+		if err != nil {
+			return fmt.Errorf("error encoding announcement: %w", err)
+		}
+
+		if !vc.Ready || vc.OpusSend == nil {
+			return errVoiceNotReady
+		}
+
+		select {
+		case <-conn.stop:
+			return errStreamStopped
+		case vc.OpusSend <- opusData:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		// The padded partial frame was the last one.
+		if readErr != nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// userAgent identifies the bot to radio-browser and stream servers, some of
+// which refuse the default agents of Go and ffmpeg. settings.UserAgent
+// overrides it.
+func userAgent() string {
+	if settings.UserAgent != "" {
+		return settings.UserAgent
+	}
+	return "radio-bot/" + version
+}
+
+// userAgentTransport sets the bot's User-Agent on requests that don't have
+// one.
+type userAgentTransport struct {
+	base http.RoundTripper
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", userAgent())
+	}
+	return t.base.RoundTrip(req)
+}
+
+// newHTTPClient returns a client sending the bot's User-Agent through base.
+func newHTTPClient(base http.RoundTripper, timeout time.Duration) *http.Client {
+	return &http.Client{Transport: userAgentTransport{base: base}, Timeout: timeout}
+}
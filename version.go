@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// The build information is set at build time, e.g. with
+// -ldflags "-X main.version=1.2.3 -X main.commit=abc1234 -X main.buildDate=2024-01-02".
+// Builds without them, like go run, report "dev".
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// buildCommit returns the commit the bot was built from, falling back to the
+// one Go records for builds in a git checkout.
+func buildCommit() string {
+	if commit != "" {
+		return commit
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	revision, modified := "", false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "unknown"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+func buildDateLabel() string {
+	if buildDate == "" {
+		return "unknown"
+	}
+	return buildDate
+}
+
+// buildInfo describes the build in one line, for the startup log.
+func buildInfo() string {
+	return fmt.Sprintf("radio-bot %s (commit %s, built %s, %s)", version, buildCommit(), buildDateLabel(), runtime.Version())
+}
+
+// available describes whether an executable can be found.
+func available(path string) string {
+	if _, err := lookPath(path); err != nil {
+		return "not found"
+	}
+	return "available"
+}
+
+func handleVersion(s *discordgo.Session, r Responder, args []string) {
+	r.Reply(fmt.Sprintf("**Version:** %s\n", version) +
+		fmt.Sprintf("**Commit:** `%s`\n", buildCommit()) +
+		fmt.Sprintf("**Built:** %s\n", buildDateLabel()) +
+		fmt.Sprintf("**Go:** %s\n", runtime.Version()) +
+		fmt.Sprintf("**ffmpeg:** %s\n", available(settings.FFmpegPath)) +
+		fmt.Sprintf("**yt-dlp:** %s", available(settings.YTDLPPath)))
+}
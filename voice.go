@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// voiceRecoverWait is how long discordgo gets to reconnect a dropped
+	// voice connection by itself before the channel is joined again.
+	voiceRecoverWait = 10 * time.Second
+	voicePollDelay   = 250 * time.Millisecond
+)
+
+var errVoiceReplaced = errors.New("voice connection was replaced")
+
+// voiceReady reports whether audio can be sent on the voice connection.
+func (c *Connection) voiceReady() bool {
+	return c.vc.Ready && c.vc.OpusSend != nil
+}
+
+// recoverVoice waits for a dropped voice connection to come back, joining
+// the same channel again when discordgo doesn't reconnect it in time. Joins
+// are retried settings.ReconnectAttempts times with the same backoff as
+// dropped streams. It returns errStreamStopped if the stream is stopped in
+// the meantime.
+func (c *Connection) recoverVoice(s *discordgo.Session) error {
+	deadline := time.Now().Add(voiceRecoverWait)
+	for !c.voiceReady() && time.Now().Before(deadline) {
+		select {
+		case <-c.stop:
+			return errStreamStopped
+		case <-time.After(voicePollDelay):
+		}
+	}
+	if c.voiceReady() {
+		return nil
+	}
+
+	var err error
+	for attempt := 0; attempt < max(settings.ReconnectAttempts, 1); attempt++ {
+		if attempt > 0 {
+			select {
+			case <-c.stop:
+				return errStreamStopped
+			case <-time.After(reconnectDelay(attempt - 1)):
+			}
+		}
+
+		voiceReconnects.Inc()
+		c.logger().Printf("Rejoining voice channel %s (attempt %d/%d)", c.vc.ChannelID, attempt+1, max(settings.ReconnectAttempts, 1))
+
+		// discordgo reuses the connection of the guild for the join, so
+		// everything holding on to c.vc keeps working.
+		vc, joinErr := s.ChannelVoiceJoin(c.vc.GuildID, c.vc.ChannelID, false, true)
+		switch {
+		case joinErr != nil:
+			err = joinErr
+		case vc != c.vc:
+			vc.Disconnect()
+			return errVoiceReplaced
+		case c.voiceReady():
+			return nil
+		default:
+			err = errVoiceNotReady
+		}
+	}
+	return fmt.Errorf("error rejoining voice channel: %w", err)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// voteSkipTimeout is how long a skip vote stays open before its tally resets.
+const voteSkipTimeout = time.Minute
+
+// addSkipVote records a skip vote from userID and returns the number of
+// distinct votes in the current tally, starting a new one if the previous
+// tally expired.
+func (c *Connection) addSkipVote(userID string) int {
+	c.skipVotesMu.Lock()
+	defer c.skipVotesMu.Unlock()
+
+	if c.skipVotes == nil || time.Since(c.skipVotesAt) > voteSkipTimeout {
+		c.skipVotes = make(map[string]bool)
+		c.skipVotesAt = time.Now()
+	}
+	c.skipVotes[userID] = true
+
+	return len(c.skipVotes)
+}
+
+func (c *Connection) resetSkipVotes() {
+	c.skipVotesMu.Lock()
+	c.skipVotes = nil
+	c.skipVotesMu.Unlock()
+}
+
+// requestSkip asks the stream to move on to the next queued station.
+func (c *Connection) requestSkip() {
+	select {
+	case c.skip <- struct{}{}:
+	default:
+	}
+}
+
+// upNext returns the station a skip moves on to: the head of the queue, or
+// the current station when the queue loops and nothing else is queued.
+func (c *Connection) upNext() (RadioStation, bool) {
+	if items := c.queue.Items(); len(items) > 0 {
+		return items[0], true
+	}
+	if c.loopMode() == loopQueue {
+		return c.currentStation(), true
+	}
+	return RadioStation{}, false
+}
+
+// replyNothingToSkipTo explains that skipping needs a queued station.
+func replyNothingToSkipTo(r Responder) {
+	r.ReplyError(fmt.Sprintf("Nothing queued to skip to. Use `%[1]senqueue` to add a station or `%[1]sstop` to stop playing.", commandPrefix(r.GuildID())))
+}
+
+// voiceListeners returns the IDs of the users other than bots in a voice
+// channel.
+func voiceListeners(s *discordgo.Session, guildID, channelID string) []string {
+	guild, err := s.State.Guild(guildID)
+	if err != nil {
+		return nil
+	}
+
+	var listeners []string
+	for _, vs := range guild.VoiceStates {
+		if vs.ChannelID != channelID {
+			continue
+		}
+		member, err := s.State.Member(guildID, vs.UserID)
+		if err == nil && member.User != nil && member.User.Bot {
+			continue
+		}
+		if vs.UserID == s.State.User.ID {
+			continue
+		}
+		listeners = append(listeners, vs.UserID)
+	}
+
+	return listeners
+}
+
+// votesNeeded returns how many votes skip a station with the given number
+// of listeners, which is more than settings.VoteSkipRatio of them.
+func votesNeeded(listeners int) int {
+	return int(math.Floor(float64(listeners)*settings.VoteSkipRatio)) + 1
+}
+
+func handleVoteSkip(s *discordgo.Session, r Responder, args []string) {
+	conn, ok := activeConnection(r.GuildID())
+	if !ok {
+		r.ReplyError("Nothing is playing.")
+		return
+	}
+
+	next, ok := conn.upNext()
+	if !ok {
+		replyNothingToSkipTo(r)
+		return
+	}
+
+	// Members who may skip directly don't need a vote.
+	if canRunCommand(s, r, "skip") {
+		conn.resetSkipVotes()
+		conn.requestSkip()
+		r.Reply(fmt.Sprintf("Skipped to %s.", next.Name))
+		return
+	}
+
+	listeners := voiceListeners(s, r.GuildID(), conn.vc.ChannelID)
+	if !slices.Contains(listeners, r.UserID()) {
+		r.ReplyError("You must be listening in the bot's voice channel to vote.")
+		return
+	}
+
+	votes := conn.addSkipVote(r.UserID())
+	needed := votesNeeded(len(listeners))
+	if votes < needed {
+		r.Reply(fmt.Sprintf("Skip vote: %d/%d.", votes, needed))
+		return
+	}
+
+	conn.resetSkipVotes()
+	conn.requestSkip()
+	r.Reply(fmt.Sprintf("Skip vote passed with %d/%d votes. Skipped to %s.", votes, needed, next.Name))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	webhookTimeout  = 5 * time.Second
+	webhookAttempts = 3
+	webhookBackoff  = time.Second
+)
+
+// Playback events sent to the webhook.
+const (
+	eventStart     = "start"
+	eventStop      = "stop"
+	eventError     = "error"
+	eventReconnect = "reconnect"
+)
+
+var webhookClient = newHTTPClient(http.DefaultTransport, webhookTimeout)
+
+type webhookEvent struct {
+	Guild     string    `json:"guild"`
+	Station   string    `json:"station"`
+	Event     string    `json:"event"`
+	Timestamp time.Time `json:"timestamp"`
+	StreamID  string    `json:"stream_id,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// notify posts a playback event of the connection to the webhook and the
+// event broker, if they are configured. Delivery happens in the background
+// so it never stalls the stream.
+func (c *Connection) notify(event string, err error) {
+	e := webhookEvent{
+		Guild:     c.vc.GuildID,
+		Station:   c.currentRadioName(),
+		Event:     event,
+		Timestamp: time.Now().UTC(),
+		StreamID:  c.id,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	if settings.WebhookURL != "" {
+		go deliverWebhook(e)
+	}
+
+	err = publisher.Publish(e)
+	if err != nil {
+		c.logger().Printf("Error publishing %s event: %v", event, err)
+	}
+}
+
+// deliverWebhook posts the event, retrying network errors and server errors
+// a few times with a growing delay.
+func deliverWebhook(e webhookEvent) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Println("Error marshalling webhook event:", err)
+		return
+	}
+
+	for attempt := 0; attempt < webhookAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(webhookBackoff << (attempt - 1))
+		}
+
+		err = postWebhook(body)
+		if err == nil {
+			return
+		}
+	}
+
+	log.Printf("Error delivering %s webhook after %d attempts: %v", e.Event, webhookAttempts, err)
+}
+
+func postWebhook(body []byte) error {
+	resp, err := webhookClient.Post(settings.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		// Client errors won't go away by retrying, so give up on this event.
+		log.Printf("Webhook rejected event: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const ytdlpTimeout = 30 * time.Second
+
+var errYTDLPMissing = errors.New("yt-dlp is not installed")
+
+// ytdlpHosts are the sites whose links are resolved with yt-dlp instead of
+// being streamed directly.
+var ytdlpHosts = map[string]bool{
+	"youtube.com":        true,
+	"www.youtube.com":    true,
+	"m.youtube.com":      true,
+	"music.youtube.com":  true,
+	"youtu.be":           true,
+	"soundcloud.com":     true,
+	"www.soundcloud.com": true,
+}
+
+// isYTDLPURL reports whether rawURL points to a site handled by yt-dlp.
+func isYTDLPURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return ytdlpHosts[strings.ToLower(u.Hostname())]
+}
+
+// ytdlpSource is a video or track page whose audio is resolved by yt-dlp.
+type ytdlpSource struct {
+	url string
+}
+
+func (ys ytdlpSource) Probe() error {
+	_, err := lookPath(settings.YTDLPPath)
+	if err != nil {
+		return errYTDLPMissing
+	}
+	return nil
+}
+
+func (ys ytdlpSource) Live() bool { return false }
+
+// StreamURL asks yt-dlp for the direct URL of the best audio format.
+func (ys ytdlpSource) StreamURL() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ytdlpTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, settings.YTDLPPath, "-f", "bestaudio/best", "--no-playlist", "-g", ys.url)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", errYTDLPMissing
+	}
+	if err != nil {
+		return "", fmt.Errorf("yt-dlp failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	streamURL, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if streamURL == "" {
+		return "", errors.New("yt-dlp found no audio")
+	}
+	return streamURL, nil
+}